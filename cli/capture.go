@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/livingsilver94/backee/installer"
+	"github.com/livingsilver94/backee/installer/stepwriter"
+)
+
+type capture struct {
+	repoFlags
+	solverFlags
+	DryRun bool `short:"d" help:"Print the files that would be captured without writing them."`
+
+	Services []string `arg:"" help:"Services whose live files are copied back into the base directory."`
+}
+
+func (c *capture) Run() error {
+	rep, err := c.repository()
+	if err != nil {
+		return err
+	}
+	srv, err := servicesByName(rep, c.Services)
+	if err != nil {
+		return err
+	}
+	opts, err := c.options(rep)
+	if err != nil {
+		return err
+	}
+	ins := installer.New(rep, stepwriter.DryRun{}, append(opts, installer.WithTags(c.variants()))...)
+	for _, s := range srv {
+		captures, err := ins.Capture(s)
+		if err != nil {
+			return err
+		}
+		if len(captures) == 0 {
+			slog.Default().WithGroup(s.Name).Info("Nothing to capture")
+			continue
+		}
+		for _, capt := range captures {
+			if c.DryRun {
+				fmt.Println(capt)
+				continue
+			}
+			slog.Default().WithGroup(s.Name).Info("Capturing " + capt.Live)
+			err := capt.Write()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
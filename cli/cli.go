@@ -22,15 +22,26 @@ func (v *flagVersion) BeforeReset() error {
 }
 
 type Globals struct {
-	NoColor bool        `help:"Do not color output (the default when in a non-interactive shell)."`
-	Quiet   bool        `short:"q" help:"Do not print anything on the terminal except errors."`
-	Version flagVersion `short:"v" help:"Print the version number and exit."`
+	NoColor     bool        `help:"Do not color output (the default when in a non-interactive shell)."`
+	Quiet       bool        `short:"q" help:"Do not print anything on the terminal except errors."`
+	ShowSecrets bool        `help:"Print the values of secret variables instead of masking them."`
+	Version     flagVersion `short:"v" help:"Print the version number and exit."`
 }
 
 type arguments struct {
 	Globals
 
-	Install install `cmd:"" default:"withargs"`
+	Install   install   `cmd:"" default:"withargs"`
+	Uninstall uninstall `cmd:"" help:"Remove links and copies of installed services."`
+	Status    status    `cmd:"" help:"Report links and copies that differ from the live filesystem."`
+	Diff      diff      `cmd:"" help:"Like status, but also print a unified diff of text files."`
+	Capture   capture   `cmd:"" help:"Copy live files of services back into the base directory."`
+	Graph     graph     `cmd:"" help:"Print the dependency graph of services."`
+	Show      show      `cmd:"" help:"Print the definition of services, merged with their variants."`
+	Validate  validate  `cmd:"" help:"Check service definitions for mistakes."`
+	Schema    schema    `cmd:"" help:"Print the JSON Schema of service files, for editors."`
+	Secrets   secrets   `cmd:"" help:"Manage the encrypted variables of services."`
+	Facts     factsCmd  `cmd:"" help:"Print the facts about this host that templates can use."`
 	// Privilege is  a hidden subcommand, not meant to be called by users.
 	// Instead, Backee will call it in a privileged fork of itself
 	// to perform filesystem operations where administration rights are required.
@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/livingsilver94/backee/facts"
+)
+
+type factsCmd struct {
+	Format string `short:"f" enum:"text,json" default:"text" help:"Output format: text or json."`
+}
+
+func (fc *factsCmd) Run() error {
+	f := facts.Gather()
+	if fc.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(f.Variables())
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, name := range f.Names() {
+		_, err := fmt.Fprintf(w, "%s%s\t%s\n", facts.Prefix, name, f[name])
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"os"
+
+	"github.com/livingsilver94/backee/service"
+)
+
+type graph struct {
+	repoFlags
+	Format string `short:"f" enum:"dot,mermaid,json" default:"dot" help:"Output format: dot, mermaid or json."`
+
+	Services []string `arg:"" optional:"" help:"Services whose dependencies are shown. Pass none to show all services in the base directory."`
+}
+
+func (g *graph) Run() error {
+	rep, err := g.repository()
+	if err != nil {
+		return err
+	}
+	var roots []*service.Service
+	if len(g.Services) == 0 {
+		roots, err = rep.AllServices()
+	} else {
+		roots, err = servicesByName(rep, g.Services)
+	}
+	if err != nil {
+		return err
+	}
+	gr, err := rep.Graph(roots)
+	if err != nil {
+		return err
+	}
+	switch g.Format {
+	case "mermaid":
+		return gr.WriteMermaid(os.Stdout)
+	case "json":
+		return gr.WriteJSON(os.Stdout)
+	default:
+		return gr.WriteDOT(os.Stdout)
+	}
+}
@@ -5,12 +5,18 @@ package cli
 
 import (
 	"errors"
+	"io/fs"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 
+	"github.com/livingsilver94/backee/facts"
 	"github.com/livingsilver94/backee/installer"
 	"github.com/livingsilver94/backee/installer/stepwriter"
+	"github.com/livingsilver94/backee/pkgmanager"
+	"github.com/livingsilver94/backee/redact"
 	"github.com/livingsilver94/backee/repo"
 	"github.com/livingsilver94/backee/repo/solver"
 	"github.com/livingsilver94/backee/service"
@@ -19,36 +25,65 @@ import (
 type keepassXC struct {
 	Path     string `env:"KEEPASSXC_PATH" help:"KeepassXC database path."`
 	Password string `env:"KEEPASSXC_PASSWORD" help:"KeepassXC database password."`
+	KeyFile  string `env:"KEEPASSXC_KEYFILE" type:"existingfile" help:"KeepassXC database key file."`
+}
+
+type pass struct {
+	Dir string `env:"PASSWORD_STORE_DIR" placeholder:"DIR" help:"Password store directory of pass. Defaults to ~/.password-store."`
+}
+
+type ageFlags struct {
+	Identity   string `env:"BACKEE_AGE_IDENTITY" type:"existingfile" help:"File of age identities that decrypt secrets."`
+	Passphrase string `env:"BACKEE_AGE_PASSPHRASE" help:"Passphrase that decrypts secrets, instead of an identity file."`
+}
+
+// repoFlags are the flags shared by commands that operate on a repository.
+type repoFlags struct {
+	Directory string   `short:"C" type:"existingdir" help:"Change the base directory."`
+	Variant   []string `placeholder:"TAG,..." help:"Tags of the system variant, most specific first. They take precedence over the variants detected from the host."`
+}
+
+// solverFlags are the flags shared by commands that solve variables.
+type solverFlags struct {
+	KeepassXC keepassXC `embed:"" prefix:"keepassxc."`
+	Pass      pass      `embed:"" prefix:"pass."`
+	Age       ageFlags  `embed:"" prefix:"age."`
+}
+
+// installFlags are the flags shared by commands that alter the system.
+type installFlags struct {
+	repoFlags
+	solverFlags
+	DryRun   bool   `short:"d" help:"Test the operation without writing any file."`
+	StateDir string `env:"BACKEE_STATE_DIR" help:"Directory where the installation manifest is stored. Defaults to $XDG_STATE_HOME/backee."`
 }
 
 type install struct {
-	Directory  string    `short:"C" type:"existingdir" help:"Change the base directory."`
-	DryRun     bool      `short:"d" help:"Test the installation without writing any file."`
-	KeepassXC  keepassXC `embed:"" prefix:"keepassxc."`
-	PkgManager []string  `name:"pkgmanager" help:"Override the package manager command for services."`
-	Variant    string    `help:"Specify the system variant."`
+	installFlags
+	Conflict   service.ConflictPolicy `placeholder:"POLICY" help:"What to do when a link or copy destination exists: fail, skip, overwrite or backup. Services may override it. By default, links fail and copies overwrite."`
+	PkgManager []string               `name:"pkgmanager" help:"Override the package manager command for services."`
+	PkgDriver  string                 `name:"pkgdriver" default:"auto" enum:"auto,dnf,zypper,apt,pacman,apk,brew,flatpak,pkcon" help:"Package manager driver for services without a package manager command: ${enum}. Auto detects the system's one."`
+	Batch      installer.PackageBatch `name:"batch-packages" placeholder:"MODE" default:"none" help:"Merge OS packages of multiple services into one package manager invocation: none, level (services of the same dependency level) or all. Setup scripts of merged services run before their packages are installed, so with all they run before the files and finalize scripts of their dependencies."`
+	Jobs       int                    `short:"j" default:"1" help:"Install up to N services that don't depend on each other at the same time."`
 
 	Services []string `arg:"" optional:"" help:"Services to install. Pass none to install all services in the base directory."`
 }
 
 const (
 	installedListFilename = "installed.txt"
+	manifestFilename      = "manifest.json"
 )
 
 func (in *install) Run() error {
-	if in.Directory == "" {
-		cwd, err := os.Getwd()
-		if err != nil {
-			return err
-		}
-		in.Directory = cwd
-	}
 	var fileList *os.File
 	defer func() {
 		fileList.Close()
 	}()
 
-	rep := repo.NewFSVariant(repo.NewOSFS(in.Directory), in.Variant)
+	rep, err := in.repository()
+	if err != nil {
+		return err
+	}
 	srv, err := in.services(rep)
 	if err == nil && len(srv) == 0 {
 		err = errors.New("no services found")
@@ -56,14 +91,41 @@ func (in *install) Run() error {
 	if err != nil {
 		return err
 	}
-	ins := in.installer(rep, &fileList)
+	// Catch dependency cycles and missing dependencies before any step runs.
 	for _, s := range srv {
-		err := ins.Install(s)
+		_, err := rep.ResolveDeps(s)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	pm, err := in.packageManager()
+	if err != nil {
+		return err
+	}
+	ins, err := in.installer(rep, &fileList,
+		installer.WithConflictPolicy(in.Conflict),
+		installer.WithJobs(in.Jobs),
+		installer.WithPackageBatch(in.Batch),
+		installer.WithPackageManager(pm),
+	)
+	if err != nil {
+		return err
+	}
+	return ins.InstallMany(srv)
+}
+
+// packageManager returns the package manager driver requested by the user.
+// When detection fails, even of the pkcon fallback, it returns nil: services with packages
+// will have to define their package manager command.
+func (in *install) packageManager() (pkgmanager.PackageManager, error) {
+	if in.PkgDriver != "auto" {
+		return pkgmanager.New(in.PkgDriver, pkgmanager.OSRunner{})
+	}
+	pm, err := pkgmanager.Detect(pkgmanager.OSRunner{})
+	if errors.Is(err, pkgmanager.ErrNotFound) {
+		return nil, nil
+	}
+	return pm, err
 }
 
 func (in *install) services(rep repo.FS) ([]*service.Service, error) {
@@ -74,51 +136,192 @@ func (in *install) services(rep repo.FS) ([]*service.Service, error) {
 	if len(in.Services) == 0 {
 		return rep.AllServices()
 	}
-	services := make([]*service.Service, 0, len(in.Services))
-	for _, name := range in.Services {
-		srv, err := rep.Service(name)
+	return servicesByName(rep, in.Services)
+}
+
+func (rf *repoFlags) repository() (repo.FS, error) {
+	if rf.Directory == "" {
+		cwd, err := os.Getwd()
 		if err != nil {
-			return nil, err
+			return repo.FS{}, err
 		}
-		services = append(services, srv)
+		rf.Directory = cwd
 	}
-	return services, nil
+	return repo.NewFSVariants(repo.NewOSFS(rf.Directory), rf.variants()...), nil
 }
 
-func (in *install) installer(rep repo.FS, fileList **os.File) installer.Installer {
-	var (
-		list installer.List
-		err  error
-	)
-	*fileList, err = os.OpenFile(installedListFilename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+// variants returns the variant tags of the host, most specific first.
+func (rf *repoFlags) variants() []string {
+	return repo.VariantCandidates(facts.Gather(), rf.Variant)
+}
+
+func (rf *installFlags) installer(rep repo.FS, fileList **os.File, extra ...installer.Option) (installer.Installer, error) {
+	solvOpts, err := rf.options(rep)
 	if err != nil {
-		slog.Error(err.Error() + "Failed opening the installation list file. Continuing without populating it")
-		list = installer.NewList()
+		return installer.Installer{}, err
+	}
+	var list installer.List
+	if rf.DryRun {
+		// Never alter the installation list on a dry run.
+		*fileList, err = os.Open(installedListFilename)
 	} else {
-		list, err = installer.NewListCached(*fileList)
-		if err != nil {
-			slog.Error("Failed reading previous installation list")
+		*fileList, err = os.OpenFile(installedListFilename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	}
+	switch {
+	case err != nil:
+		if !rf.DryRun || !errors.Is(err, fs.ErrNotExist) {
+			slog.Error(err.Error() + "Failed opening the installation list file. Continuing without populating it")
 		}
+		list, err = installer.NewList(), nil
+	case rf.DryRun:
+		list, err = installer.NewListFrom(*fileList)
+	default:
+		list, err = installer.NewListCached(*fileList)
+	}
+	if err != nil {
+		slog.Error("Failed reading previous installation list")
+	}
+
+	man, err := rf.manifest(list)
+	if err != nil {
+		slog.Error(err.Error() + ". Continuing without the installation manifest")
+		man = nil
 	}
 
 	writ := installer.StepWriter(stepwriter.OS{})
-	if in.DryRun {
+	if rf.DryRun {
 		writ = stepwriter.DryRun{
-			FS: repo.NewOSFS(in.Directory),
+			FS: repo.NewOSFS(rf.Directory),
 		}
 	}
-	opts := []installer.Option{
-		installer.WithCommonVars(envVars()),
+	opts := append(
+		solvOpts,
 		installer.WithList(list),
+		installer.WithTags(rf.variants()),
+	)
+	if man != nil {
+		opts = append(opts, installer.WithManifest(man))
+	}
+	opts = append(opts, extra...)
+	return installer.New(rep, writ, opts...), nil
+}
+
+// options returns the installer options to solve variables
+// of services in rep, and decrypt their files.
+func (sf *solverFlags) options(rep repo.FS) ([]installer.Option, error) {
+	conf, err := rep.Config()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := sf.Age.identities()
+	if err != nil {
+		return nil, err
+	}
+	// Credentials may be in environment variables, which templates can use.
+	redact.Default.Add(sf.KeepassXC.Password)
+	redact.Default.Add(sf.Age.Passphrase)
+	common := envVars()
+	for name, val := range facts.Gather().Variables() {
+		common[name] = val
+	}
+	backends := make(map[string][]string, len(conf.Exec))
+	for name, cmd := range conf.Exec {
+		backends[name] = cmd
+	}
+	dec := solver.NewAge(ids...).WithPrompt(terminalPrompt("--age.identity or $BACKEE_AGE_PASSPHRASE"))
+	solvers := map[service.VarKind]repo.VarSolver{
+		solver.PassKind:   solver.NewPass(sf.Pass.Dir),
+		solver.ExecKind:   solver.NewExec(backends),
+		service.Encrypted: dec,
+	}
+	if sf.KeepassXC.Path != "" {
+		solvers[solver.KeepassXCKind] = solver.NewKeepassXC(sf.KeepassXC.Path, sf.KeepassXC.Password, sf.KeepassXC.KeyFile).
+			WithPrompt(terminalPrompt("--keepassxc.password or $KEEPASSXC_PASSWORD"))
+	}
+	return []installer.Option{
+		installer.WithCommonVars(common),
+		installer.WithVarSolvers(solvers),
+		installer.WithDecrypter(dec),
+	}, nil
+}
+
+// manifest loads the installation manifest from the state directory.
+// Services in list are imported into a brand new manifest,
+// although the files they wrote are unknown.
+func (rf *installFlags) manifest(list installer.List) (*installer.Manifest, error) {
+	dir := rf.StateDir
+	if dir == "" {
+		var err error
+		dir, err = stateDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	path := filepath.Join(dir, manifestFilename)
+	var (
+		man *installer.Manifest
+		err error
+	)
+	if rf.DryRun {
+		man, err = manifestReadOnly(path)
+	} else {
+		man, err = installer.LoadManifest(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(man.Services) == 0 {
+		for _, name := range list.Names() {
+			if name != "" {
+				man.Set(name, installer.ServiceRecord{})
+			}
+		}
+	}
+	return man, nil
+}
+
+func manifestReadOnly(path string) (*installer.Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return installer.NewManifest(), nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	return installer.NewManifestFrom(file)
+}
+
+// stateDir returns the directory where Backee stores its state,
+// following the XDG Base Directory specification.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "backee"), nil
+	}
+	if runtime.GOOS == "windows" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "backee"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
 	}
-	if in.KeepassXC.Path != "" {
-		kee := solver.NewKeepassXC(in.KeepassXC.Path, in.KeepassXC.Password)
-		opts = append(
-			opts,
-			installer.WithVarSolvers(map[service.VarKind]repo.VarSolver{"keepassxc": kee}),
-		)
+	return filepath.Join(home, ".local", "state", "backee"), nil
+}
+
+func servicesByName(rep repo.FS, names []string) ([]*service.Service, error) {
+	services := make([]*service.Service, 0, len(names))
+	for _, name := range names {
+		srv, err := rep.Service(name)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, srv)
 	}
-	return installer.New(rep, writ, opts...)
+	return services, nil
 }
 
 // envVars returns a map of environment variables.
@@ -4,6 +4,7 @@
 package cli
 
 import (
+	"errors"
 	"os"
 
 	_ "github.com/livingsilver94/backee/installer/stepwriter"
@@ -17,5 +18,9 @@ func (p privilege) Run() error {
 	if err != nil {
 		return err
 	}
-	return run.RunPrivileged()
+	err = run.RunPrivileged()
+	if errors.Is(err, priv.ErrUnchanged) {
+		os.Exit(priv.ExitUnchanged)
+	}
+	return err
 }
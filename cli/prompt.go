@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+
+	"github.com/livingsilver94/backee/redact"
+	"github.com/livingsilver94/backee/repo/solver"
+)
+
+// promptMu prevents concurrent prompts from mixing on the terminal.
+var promptMu sync.Mutex
+
+// terminalPrompt returns a solver.Prompt that reads credentials from the terminal,
+// with echo turned off. If the standard input is not a terminal, the prompt fails
+// suggesting hint, such as a flag, to pass the credential instead.
+func terminalPrompt(hint string) solver.Prompt {
+	return func(msg string) (string, error) {
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return "", fmt.Errorf("%s is required but the standard input is not a terminal: pass %s", msg, hint)
+		}
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		fmt.Fprintf(os.Stderr, "%s: ", msg)
+		cred, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		redact.Default.Add(string(cred))
+		return string(cred), nil
+	}
+}
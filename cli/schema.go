@@ -0,0 +1,21 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/livingsilver94/backee/repo"
+)
+
+type schema struct{}
+
+func (schema) Run() error {
+	data, err := repo.JSONSchema()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,410 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/livingsilver94/backee/repo"
+	"github.com/livingsilver94/backee/repo/solver"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+type secrets struct {
+	Edit   secretsEdit   `cmd:"" help:"Edit the secrets of a service in a text editor, and encrypt them again on exit."`
+	Set    secretsSet    `cmd:"" help:"Encrypt a secret of a service, reading its value from the standard input, or the terminal with echo turned off."`
+	Delete secretsDelete `cmd:"" help:"Delete a secret of a service."`
+}
+
+// secretsFlags are the flags shared by secrets subcommands.
+type secretsFlags struct {
+	repoFlags
+	Age ageFlags `embed:"" prefix:"age."`
+}
+
+type secretsEdit struct {
+	secretsFlags
+
+	Service string `arg:"" help:"Service whose secrets are edited."`
+}
+
+type secretsSet struct {
+	secretsFlags
+
+	Service string `arg:"" help:"Service the secret belongs to."`
+	Name    string `arg:"" help:"Name of the variable."`
+}
+
+type secretsDelete struct {
+	repoFlags
+
+	Service string `arg:"" help:"Service the secret belongs to."`
+	Name    string `arg:"" help:"Name of the variable."`
+}
+
+func (s *secretsDelete) Run() error {
+	sf := secretsFlags{repoFlags: s.repoFlags}
+	file, err := sf.open(s.Service)
+	if err != nil {
+		return err
+	}
+	if !file.remove(s.Name) {
+		return fmt.Errorf("%s has no secret named %s", s.Service, s.Name)
+	}
+	return file.write()
+}
+
+func (s *secretsSet) Run() error {
+	file, err := s.open(s.Service)
+	if err != nil {
+		return err
+	}
+	rcpts, err := s.recipients()
+	if err != nil {
+		return err
+	}
+	var plain string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		plain, err = terminalPrompt("")("Value of " + s.Name)
+	} else {
+		var val []byte
+		val, err = io.ReadAll(os.Stdin)
+		plain = strings.TrimSuffix(strings.TrimSuffix(string(val), "\n"), "\r")
+	}
+	if err != nil {
+		return err
+	}
+	enc, err := solver.Encrypt(plain, rcpts...)
+	if err != nil {
+		return err
+	}
+	file.set(s.Name, enc)
+	return file.write()
+}
+
+func (s *secretsEdit) Run() error {
+	file, err := s.open(s.Service)
+	if err != nil {
+		return err
+	}
+	ids, err := s.Age.identities()
+	if err != nil {
+		return err
+	}
+	rcpts, err := s.recipients()
+	if err != nil {
+		return err
+	}
+	dec := solver.NewAge(ids...).WithPrompt(terminalPrompt("--age.identity or $BACKEE_AGE_PASSPHRASE"))
+	old := make(map[string]string, len(file.names()))
+	plain := &yaml.Node{Kind: yaml.MappingNode, HeadComment: fmt.Sprintf("Secrets of %s. They are encrypted again when the editor exits.", s.Service)}
+	for _, name := range file.names() {
+		val, err := dec.Value(file.get(name))
+		if err != nil {
+			return fmt.Errorf("decrypting %s: %w", name, err)
+		}
+		old[name] = val
+		plain.Content = append(plain.Content, scalarNode(name), scalarNode(val))
+	}
+	orig, err := yaml.Marshal(plain)
+	if err != nil {
+		return err
+	}
+	data, err := editInMemory(orig)
+	if err != nil {
+		return err
+	}
+	log := slog.Default().WithGroup(s.Service)
+	if bytes.Equal(data, orig) {
+		log.Info("Secrets unchanged")
+		return nil
+	}
+
+	var edited yaml.Node
+	err = yaml.Unmarshal(data, &edited)
+	if err != nil {
+		return err
+	}
+	var values map[string]string
+	err = edited.Decode(&values)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		// Emptying the editor is how users abort, not how they delete every secret.
+		log.Info("Secrets unchanged, because the edited file is empty. Run `backee secrets delete` to delete them")
+		return nil
+	}
+	updated := secretsFile{path: file.path, doc: &yaml.Node{Kind: yaml.MappingNode}}
+	if len(edited.Content) != 0 {
+		for i := 0; i < len(edited.Content[0].Content); i += 2 {
+			name := edited.Content[0].Content[i].Value
+			if val, ok := old[name]; ok && val == values[name] {
+				// Keep the ciphertext of unchanged secrets, not to clutter diffs.
+				updated.set(name, file.get(name))
+				continue
+			}
+			enc, err := solver.Encrypt(values[name], rcpts...)
+			if err != nil {
+				return err
+			}
+			updated.set(name, enc)
+		}
+	}
+	return updated.write()
+}
+
+// open opens the secrets file of the service named name.
+func (sf *secretsFlags) open(name string) (secretsFile, error) {
+	rep, err := sf.repository()
+	if err != nil {
+		return secretsFile{}, err
+	}
+	_, err = rep.ServiceLayers(name)
+	if err != nil {
+		return secretsFile{}, err
+	}
+	return openSecretsFile(filepath.Join(sf.Directory, name, repo.SecretsFilename))
+}
+
+// recipients returns the recipients secrets are encrypted for:
+// those of the repository's configuration, or else those of the identities.
+func (sf *secretsFlags) recipients() ([]age.Recipient, error) {
+	rep, err := sf.repository()
+	if err != nil {
+		return nil, err
+	}
+	conf, err := rep.Config()
+	if err != nil {
+		return nil, err
+	}
+	if len(conf.Age.Recipients) != 0 {
+		return age.ParseRecipients(strings.NewReader(strings.Join(conf.Age.Recipients, "\n")))
+	}
+	if sf.Age.Passphrase != "" {
+		rcpt, err := age.NewScryptRecipient(sf.Age.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{rcpt}, nil
+	}
+	ids, err := sf.Age.identities()
+	if err != nil {
+		return nil, err
+	}
+	var rcpts []age.Recipient
+	for _, id := range ids {
+		if x, ok := id.(*age.X25519Identity); ok {
+			rcpts = append(rcpts, x.Recipient())
+		}
+	}
+	if len(rcpts) == 0 {
+		return nil, fmt.Errorf("no age recipients: list them in %s or pass --age.identity", repo.ConfigFilename)
+	}
+	return rcpts, nil
+}
+
+// identities returns the age identities of the flags, if any.
+func (af *ageFlags) identities() ([]age.Identity, error) {
+	if af.Passphrase != "" {
+		id, err := age.NewScryptIdentity(af.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Identity{id}, nil
+	}
+	if af.Identity == "" {
+		return nil, nil
+	}
+	file, err := os.Open(af.Identity)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	ids, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", af.Identity, err)
+	}
+	return ids, nil
+}
+
+// secretsFile is the secrets file of a service, as in repo.SecretsFilename.
+type secretsFile struct {
+	path string
+	doc  *yaml.Node
+}
+
+func openSecretsFile(path string) (secretsFile, error) {
+	file := secretsFile{path: path, doc: &yaml.Node{Kind: yaml.MappingNode}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return file, nil
+		}
+		return file, err
+	}
+	var doc yaml.Node
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return file, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) != 0 {
+		var check map[string]string
+		if err := doc.Decode(&check); err != nil {
+			return file, fmt.Errorf("%s: %w", path, err)
+		}
+		file.doc = doc.Content[0]
+	}
+	return file, nil
+}
+
+// names returns the names of the secrets, in order.
+func (f secretsFile) names() []string {
+	names := make([]string, 0, len(f.doc.Content)/2)
+	for i := 0; i < len(f.doc.Content); i += 2 {
+		names = append(names, f.doc.Content[i].Value)
+	}
+	return names
+}
+
+func (f secretsFile) get(name string) string {
+	for i := 0; i < len(f.doc.Content); i += 2 {
+		if f.doc.Content[i].Value == name {
+			return f.doc.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// set sets the encrypted value of a secret, adding it if it's new.
+func (f secretsFile) set(name, enc string) {
+	val := scalarNode(enc)
+	for i := 0; i < len(f.doc.Content); i += 2 {
+		if f.doc.Content[i].Value == name {
+			f.doc.Content[i+1] = val
+			return
+		}
+	}
+	f.doc.Content = append(f.doc.Content, scalarNode(name), val)
+}
+
+// remove removes a secret, and returns whether it was present.
+func (f secretsFile) remove(name string) bool {
+	for i := 0; i < len(f.doc.Content); i += 2 {
+		if f.doc.Content[i].Value == name {
+			f.doc.Content = slices.Delete(f.doc.Content, i, i+2)
+			return true
+		}
+	}
+	return false
+}
+
+// write replaces the file on disk atomically.
+// It removes the file if there are no secrets.
+func (f secretsFile) write() error {
+	if len(f.doc.Content) == 0 {
+		err := os.Remove(f.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	data, err := yaml.Marshal(f.doc)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), "."+repo.SecretsFilename+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func scalarNode(val string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: val}
+	if strings.Contains(val, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	return node
+}
+
+// editInMemory lets the user edit data in their text editor, and returns the result.
+// The file being edited lives in a memory-backed directory,
+// so that it never reaches the disk.
+func editInMemory(data []byte) ([]byte, error) {
+	dir, err := memoryDir()
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, "backee-secrets-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	size := len(data)
+	defer func() {
+		// Overwrite the plain text before removing the file, in case it's swapped out.
+		os.WriteFile(tmp.Name(), make([]byte, size), 0o600)
+		os.Remove(tmp.Name())
+	}()
+	_, err = tmp.Write(data)
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	editor := strings.Fields(os.Getenv("VISUAL"))
+	if len(editor) == 0 {
+		editor = strings.Fields(os.Getenv("EDITOR"))
+	}
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], tmp.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("running the editor: %w", err)
+	}
+	edited, err := os.ReadFile(tmp.Name())
+	size = max(size, len(edited))
+	return edited, err
+}
+
+// memoryDir returns a directory whose files are kept in memory.
+func memoryDir() (string, error) {
+	if runtime.GOOS == "linux" {
+		for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+			if dir == "" {
+				continue
+			}
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				return dir, nil
+			}
+		}
+	}
+	return "", errors.New("no memory-backed directory to edit secrets in: use `backee secrets set` instead")
+}
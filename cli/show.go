@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type show struct {
+	repoFlags
+
+	Services []string `arg:"" help:"Services to show."`
+}
+
+func (s *show) Run() error {
+	rep, err := s.repository()
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(4)
+	for _, name := range s.Services {
+		// Parse the service to report errors in the merged document.
+		_, err := rep.Service(name)
+		if err != nil {
+			return err
+		}
+		node, layers, err := rep.ServiceNode(name)
+		if err != nil {
+			return err
+		}
+		if node == nil {
+			node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		node.HeadComment = "Merged from " + strings.Join(layers, ", ")
+		err = enc.Encode(node)
+		if err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/livingsilver94/backee/installer"
+	"github.com/livingsilver94/backee/installer/stepwriter"
+)
+
+type status struct {
+	repoFlags
+	solverFlags
+
+	Services []string `arg:"" optional:"" help:"Services to check. Pass none to check all services in the base directory."`
+}
+
+func (st *status) Run() error {
+	return st.checkDrift(false)
+}
+
+type diff struct {
+	status
+}
+
+func (d *diff) Run() error {
+	return d.checkDrift(true)
+}
+
+// checkDrift compares links and copies of services, and their dependencies,
+// with the live filesystem. When patch is true, text files that differ
+// are printed as unified diffs.
+func (st *status) checkDrift(patch bool) error {
+	rep, err := st.repository()
+	if err != nil {
+		return err
+	}
+	srv, err := servicesByName(rep, st.Services)
+	if len(st.Services) == 0 {
+		srv, err = rep.AllServices()
+	}
+	if err == nil && len(srv) == 0 {
+		err = errors.New("no services found")
+	}
+	if err != nil {
+		return err
+	}
+	writ := &stepwriter.Diff{Patch: patch}
+	opts, err := st.options(rep)
+	if err != nil {
+		return err
+	}
+	// Packages aren't compared, so no package manager is needed.
+	opts = append(opts, installer.WithTags(st.variants()), installer.WithoutPackages())
+	ins := installer.New(rep, writ, opts...)
+	for _, s := range srv {
+		err := ins.Install(s)
+		if err != nil {
+			return err
+		}
+	}
+	if writ.Drifts != 0 {
+		return fmt.Errorf("found %d differences with the live filesystem", writ.Drifts)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/livingsilver94/backee/installer"
+	"github.com/livingsilver94/backee/repo"
+	"github.com/livingsilver94/backee/service"
+)
+
+type uninstall struct {
+	installFlags
+	Recursive bool `short:"r" help:"Uninstall installed dependents first, instead of refusing."`
+
+	Services []string `arg:"" help:"Services to uninstall."`
+}
+
+func (un *uninstall) Run() error {
+	var fileList *os.File
+	defer func() {
+		fileList.Close()
+	}()
+
+	rep, err := un.repository()
+	if err != nil {
+		return err
+	}
+	srv, err := servicesByName(rep, un.Services)
+	if err != nil {
+		return err
+	}
+	ins, err := un.installer(rep, &fileList)
+	if err != nil {
+		return err
+	}
+	for _, s := range srv {
+		err := un.uninstall(rep, &ins, s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uninstall uninstalls srv after its installed dependents, if the Recursive flag is set.
+// Otherwise, it refuses to uninstall a service that other installed services depend on.
+func (un *uninstall) uninstall(rep repo.FS, ins *installer.Installer, srv *service.Service) error {
+	dependents, err := rep.Dependents(srv.Name)
+	if err != nil {
+		return err
+	}
+	for _, dep := range dependents {
+		if !ins.IsInstalled(dep.Name) {
+			continue
+		}
+		if !un.Recursive {
+			return fmt.Errorf("cannot uninstall %s: %s depends on it", srv.Name, dep.Name)
+		}
+		err := un.uninstall(rep, ins, dep)
+		if err != nil {
+			return err
+		}
+	}
+	return ins.Uninstall(srv)
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/livingsilver94/backee/facts"
+)
+
+type validate struct {
+	repoFlags
+
+	Services []string `arg:"" optional:"" help:"Services to validate. Pass none to validate all services in the base directory."`
+}
+
+func (v *validate) Run() error {
+	rep, err := v.repository()
+	if err != nil {
+		return err
+	}
+	names := v.Services
+	if len(names) == 0 {
+		names, err = rep.ServiceNames()
+		if err != nil {
+			return err
+		}
+	}
+	var common []string
+	for name := range envVars() {
+		common = append(common, name)
+	}
+	for name := range facts.Gather().Variables() {
+		common = append(common, name)
+	}
+
+	// Fragments shared by services would be reported once per service.
+	seen := make(map[string]struct{})
+	for _, name := range names {
+		for _, diag := range rep.Validate(name, common) {
+			if diag.File != "" {
+				diag.File = v.relPath(diag.File)
+			}
+			msg := diag.Error()
+			if _, ok := seen[msg]; ok {
+				continue
+			}
+			seen[msg] = struct{}{}
+			fmt.Println(msg)
+		}
+	}
+	if len(seen) != 0 {
+		return fmt.Errorf("found %d problems", len(seen))
+	}
+	return nil
+}
+
+// relPath returns the path of the repository file fpath
+// relative to the current directory, when possible.
+func (v *validate) relPath(fpath string) string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fpath
+	}
+	rel, err := filepath.Rel(cwd, filepath.Join(v.Directory, filepath.FromSlash(fpath)))
+	if err != nil {
+		return fpath
+	}
+	return rel
+}
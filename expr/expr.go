@@ -0,0 +1,465 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package expr evaluates the boolean expressions that make
+// entries of services conditional.
+//
+// An expression compares strings and booleans with == and !=,
+// and combines booleans with &&, || and !. Operands are
+// strings quoted with " or ', the true and false keywords, variables,
+// and function calls such as defined("name"). Parentheses group operands.
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUndefined is returned when an expression refers to an unknown variable or function.
+var ErrUndefined = errors.New("undefined")
+
+// Func is a function that expressions may call.
+type Func func(args ...string) (bool, error)
+
+// Env is the environment where expressions are evaluated.
+type Env struct {
+	// Lookup returns the value of the variable named name,
+	// and whether it exists.
+	Lookup func(name string) (string, bool)
+	// Funcs are the functions available to expressions, by name.
+	// The defined function, which reports whether a variable exists,
+	// is always available.
+	Funcs map[string]Func
+}
+
+// SyntaxError reports an invalid expression.
+type SyntaxError struct {
+	// Pos is the byte offset of the error in the expression.
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at column %d: %s", e.Pos+1, e.Msg)
+}
+
+// Expr is a parsed expression.
+type Expr struct {
+	root node
+}
+
+// Parse parses the expression s.
+func Parse(s string) (Expr, error) {
+	p := parser{lex: lexer{src: s}}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return Expr{}, err
+	}
+	if p.tok.kind != tokEOF {
+		return Expr{}, p.errorf("unexpected %s", p.tok)
+	}
+	return Expr{root: root}, nil
+}
+
+// Eval parses and evaluates the expression s in env.
+func Eval(s string, env Env) (bool, error) {
+	e, err := Parse(s)
+	if err != nil {
+		return false, err
+	}
+	return e.Eval(env)
+}
+
+// Eval evaluates e in env. The result must be a boolean,
+// or one of the strings "true" and "false".
+func (e Expr) Eval(env Env) (bool, error) {
+	val, err := e.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return val.boolean()
+}
+
+// value is either a string or a boolean.
+type value struct {
+	str    string
+	b      bool
+	isBool bool
+}
+
+func (v value) boolean() (bool, error) {
+	if v.isBool {
+		return v.b, nil
+	}
+	switch v.str {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not a boolean", v.str)
+}
+
+func (v value) String() string {
+	if v.isBool {
+		return fmt.Sprint(v.b)
+	}
+	return fmt.Sprintf("%q", v.str)
+}
+
+type node interface {
+	eval(env Env) (value, error)
+}
+
+type (
+	literal  struct{ val value }
+	variable struct{ name string }
+	call     struct {
+		name string
+		args []node
+	}
+	not    struct{ operand node }
+	binary struct {
+		op          tokenKind
+		left, right node
+	}
+)
+
+func (n literal) eval(Env) (value, error) {
+	return n.val, nil
+}
+
+func (n variable) eval(env Env) (value, error) {
+	if env.Lookup != nil {
+		if val, ok := env.Lookup(n.name); ok {
+			return value{str: val}, nil
+		}
+	}
+	return value{}, fmt.Errorf("variable %q: %w", n.name, ErrUndefined)
+}
+
+func (n call) eval(env Env) (value, error) {
+	args := make([]string, 0, len(n.args))
+	for _, arg := range n.args {
+		val, err := arg.eval(env)
+		if err != nil {
+			return value{}, err
+		}
+		if val.isBool {
+			return value{}, fmt.Errorf("%s: argument %s is not a string", n.name, val)
+		}
+		args = append(args, val.str)
+	}
+	if n.name == "defined" {
+		if len(args) != 1 {
+			return value{}, fmt.Errorf("defined: expected 1 argument, got %d", len(args))
+		}
+		ok := false
+		if env.Lookup != nil {
+			_, ok = env.Lookup(args[0])
+		}
+		return value{b: ok, isBool: true}, nil
+	}
+	fn, ok := env.Funcs[n.name]
+	if !ok {
+		return value{}, fmt.Errorf("function %q: %w", n.name, ErrUndefined)
+	}
+	b, err := fn(args...)
+	if err != nil {
+		return value{}, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return value{b: b, isBool: true}, nil
+}
+
+func (n not) eval(env Env) (value, error) {
+	val, err := n.operand.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+	b, err := val.boolean()
+	if err != nil {
+		return value{}, err
+	}
+	return value{b: !b, isBool: true}, nil
+}
+
+func (n binary) eval(env Env) (value, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return value{}, err
+	}
+	switch n.op {
+	case tokAnd, tokOr:
+		lb, err := left.boolean()
+		if err != nil {
+			return value{}, err
+		}
+		// Short-circuit evaluation.
+		if (n.op == tokAnd && !lb) || (n.op == tokOr && lb) {
+			return value{b: lb, isBool: true}, nil
+		}
+		right, err := n.right.eval(env)
+		if err != nil {
+			return value{}, err
+		}
+		rb, err := right.boolean()
+		return value{b: rb, isBool: true}, err
+	default:
+		right, err := n.right.eval(env)
+		if err != nil {
+			return value{}, err
+		}
+		if left.isBool != right.isBool {
+			return value{}, fmt.Errorf("cannot compare %s with %s", left, right)
+		}
+		eq := left == right
+		if n.op == tokNeq {
+			eq = !eq
+		}
+		return value{b: eq, isBool: true}, nil
+	}
+}
+
+// parser is a recursive descent parser. Precedence, from the lowest, is:
+// ||, &&, == and !=, !.
+type parser struct {
+	lex lexer
+	tok token
+	err error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lex.next()
+}
+
+func (p *parser) errorf(format string, a ...any) error {
+	if p.err != nil {
+		return p.err
+	}
+	return &SyntaxError{Pos: p.tok.pos, Msg: fmt.Sprintf(format, a...)}
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.tok.kind == tokOr {
+		p.next()
+		var right node
+		right, err = p.parseAnd()
+		left = binary{op: tokOr, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	for err == nil && p.tok.kind == tokAnd {
+		p.next()
+		var right node
+		right, err = p.parseComparison()
+		left = binary{op: tokAnd, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.tok.kind; op == tokEq || op == tokNeq {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if k := p.tok.kind; k == tokEq || k == tokNeq {
+			return nil, p.errorf("comparisons cannot be chained")
+		}
+		return binary{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.tok.kind == tokNot {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not{operand: operand}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *parser) parseOperand() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokString:
+		p.next()
+		return literal{val: value{str: tok.text}}, p.err
+	case tokIdent:
+		p.next()
+		if p.tok.kind == tokLParen {
+			return p.parseCall(tok.text)
+		}
+		switch tok.text {
+		case "true":
+			return literal{val: value{b: true, isBool: true}}, p.err
+		case "false":
+			return literal{val: value{b: false, isBool: true}}, p.err
+		}
+		return variable{name: tok.text}, p.err
+	case tokLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ) but found %s", p.tok)
+		}
+		p.next()
+		return inner, p.err
+	default:
+		return nil, p.errorf("unexpected %s", tok)
+	}
+}
+
+func (p *parser) parseCall(name string) (node, error) {
+	p.next() // Skip "(".
+	c := call{name: name}
+	for p.tok.kind != tokRParen {
+		if len(c.args) != 0 {
+			if p.tok.kind != tokComma {
+				return nil, p.errorf("expected , or ) but found %s", p.tok)
+			}
+			p.next()
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+	}
+	p.next()
+	return c, p.err
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokString
+	tokIdent
+	tokEq
+	tokNeq
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return fmt.Sprintf("string %q", t.text)
+	case tokIdent:
+		return fmt.Sprintf("identifier %s", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+var operators = []struct {
+	text string
+	kind tokenKind
+}{
+	{"==", tokEq}, {"!=", tokNeq}, {"&&", tokAnd}, {"||", tokOr},
+	{"!", tokNot}, {"(", tokLParen}, {")", tokRParen}, {",", tokComma},
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && isSpace(l.src[l.pos]) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos == len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[l.pos:], op.text) {
+			l.pos += len(op.text)
+			return token{kind: op.kind, text: op.text, pos: start}, nil
+		}
+	}
+	c := l.src[l.pos]
+	switch {
+	case c == '"' || c == '\'':
+		return l.lexString(c)
+	case isIdentStart(c):
+		for l.pos < len(l.src) && isIdent(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}, nil
+	default:
+		return token{}, &SyntaxError{Pos: start, Msg: fmt.Sprintf("unexpected character %q", c)}
+	}
+}
+
+// lexString lexes a string enclosed by quote.
+// A backslash escapes the following character.
+func (l *lexer) lexString(quote byte) (token, error) {
+	start := l.pos
+	l.pos++
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			return token{kind: tokString, text: b.String(), pos: start}, nil
+		case c == '\\' && l.pos+1 < len(l.src):
+			b.WriteByte(l.src[l.pos+1])
+			l.pos += 2
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, &SyntaxError{Pos: start, Msg: "unterminated string"}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// isIdent reports whether c may be part of an identifier.
+// Dots and dashes are allowed so that variables such as facts.os can be named.
+func isIdent(c byte) bool {
+	return isIdentStart(c) || ('0' <= c && c <= '9') || c == '.' || c == '-'
+}
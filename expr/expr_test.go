@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package expr_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/livingsilver94/backee/expr"
+)
+
+var testEnv = expr.Env{
+	Lookup: func(name string) (string, bool) {
+		val, ok := map[string]string{
+			"os":          "linux",
+			"facts.arch":  "amd64",
+			"enabled":     "true",
+			"quoted":      `it's "here"`,
+			"my-variable": "x",
+		}[name]
+		return val, ok
+	},
+	Funcs: map[string]expr.Func{
+		"tagged": func(args ...string) (bool, error) {
+			return slices.Contains(args, "laptop"), nil
+		},
+		"fail": func(...string) (bool, error) {
+			return false, errors.New("failure")
+		},
+	},
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`true`, true},
+		{`false`, false},
+		{`os == "linux"`, true},
+		{`os == 'windows'`, false},
+		{`os != "windows"`, true},
+		{`"linux" == os`, true},
+		{`facts.arch == "amd64" && os == "linux"`, true},
+		{`os == "windows" || facts.arch == "amd64"`, true},
+		{`!(os == "linux")`, false},
+		{`!!true`, true},
+		{`enabled`, true},
+		{`enabled == "true"`, true},
+		{`true == (os == "linux")`, true},
+		{`tagged("laptop")`, true},
+		{`tagged("desktop", "server")`, false},
+		{`!tagged("desktop") && defined("os")`, true},
+		{`defined("missing")`, false},
+		{`defined("my-variable")`, true},
+		{`quoted == 'it\'s "here"'`, true},
+		{`false && undefined == "x"`, false},
+		{`true || fail()`, true},
+		{`os == "windows" || os == "linux" && facts.arch == "arm64"`, false},
+		{`(os == "windows" || os == "linux") && facts.arch == "amd64"`, true},
+	}
+	for _, test := range tests {
+		obtained, err := expr.Eval(test.expr, testEnv)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", test.expr, err)
+		}
+		if obtained != test.expected {
+			t.Fatalf("%s: expected %t. Got %t", test.expr, test.expected, obtained)
+		}
+	}
+}
+
+func TestEvalError(t *testing.T) {
+	tests := []struct {
+		expr   string
+		target error
+	}{
+		{`missing == "x"`, expr.ErrUndefined},
+		{`unknown()`, expr.ErrUndefined},
+		{`fail()`, nil},
+		{`os`, nil},
+		{`os == true`, nil},
+		{`tagged(true)`, nil},
+		{`defined()`, nil},
+	}
+	for _, test := range tests {
+		_, err := expr.Eval(test.expr, testEnv)
+		if err == nil {
+			t.Fatalf("%s: expected an error", test.expr)
+		}
+		if test.target != nil && !errors.Is(err, test.target) {
+			t.Fatalf("%s: expected %v. Got %v", test.expr, test.target, err)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{``, 0},
+		{`os ==`, 5},
+		{`os = "linux"`, 3},
+		{`(os == "linux"`, 14},
+		{`"unterminated`, 0},
+		{`os == "a" == "b"`, 10},
+		{`tagged("a" "b")`, 11},
+		{`os == "linux")`, 13},
+		{`&& true`, 0},
+	}
+	for _, test := range tests {
+		_, err := expr.Parse(test.expr)
+		var synErr *expr.SyntaxError
+		if !errors.As(err, &synErr) {
+			t.Fatalf("%s: expected a syntax error. Got %v", test.expr, err)
+		}
+		if synErr.Pos != test.pos {
+			t.Fatalf("%s: expected error at %d. Got %d (%v)", test.expr, test.pos, synErr.Pos, err)
+		}
+	}
+}
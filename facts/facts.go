@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package facts gathers information about the host Backee runs on.
+package facts
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefix precedes the name of facts when they are variables.
+const Prefix = "facts."
+
+// Facts maps fact names to their value.
+// Facts that could not be determined are absent.
+type Facts map[string]string
+
+// Gather collects the facts of the running host.
+func Gather() Facts {
+	return GatherFS(os.DirFS("/"))
+}
+
+// GatherFS collects the facts of the running host,
+// reading system files such as etc/os-release from root.
+func GatherFS(root fs.FS) Facts {
+	f := Facts{
+		"os":   runtime.GOOS,
+		"arch": runtime.GOARCH,
+		"cpus": strconv.Itoa(runtime.NumCPU()),
+	}
+	if host, err := os.Hostname(); err == nil {
+		f["hostname"] = host
+	}
+	f.gatherDistro(root)
+	f.gatherKernel(root)
+	f.gatherMemory(root)
+	f.gatherUser(root)
+	f.gatherXDG()
+	return f
+}
+
+// Variables returns the facts named with Prefix.
+func (f Facts) Variables() map[string]string {
+	vars := make(map[string]string, len(f))
+	for name, val := range f {
+		vars[Prefix+name] = val
+	}
+	return vars
+}
+
+// Names returns the sorted fact names.
+func (f Facts) Names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// set sets the fact name, unless val is empty.
+func (f Facts) set(name, val string) {
+	if val != "" {
+		f[name] = val
+	}
+}
+
+func (f Facts) gatherDistro(root fs.FS) {
+	file, err := root.Open("etc/os-release")
+	if err != nil {
+		file, err = root.Open("usr/lib/os-release")
+		if err != nil {
+			return
+		}
+	}
+	defer file.Close()
+	rel, err := ParseOSRelease(file)
+	if err != nil {
+		return
+	}
+	f.set("distro.id", rel["ID"])
+	f.set("distro.like", rel["ID_LIKE"])
+	f.set("distro.version", rel["VERSION_ID"])
+	f.set("distro.name", rel["NAME"])
+}
+
+func (f Facts) gatherKernel(root fs.FS) {
+	rel, err := fs.ReadFile(root, "proc/sys/kernel/osrelease")
+	if err != nil {
+		rel, err = exec.Command("uname", "-r").Output()
+		if err != nil {
+			return
+		}
+	}
+	f.set("kernel", strings.TrimSpace(string(rel)))
+}
+
+func (f Facts) gatherMemory(root fs.FS) {
+	file, err := root.Open("proc/meminfo")
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scan := bufio.NewScanner(file)
+	for scan.Scan() {
+		// The line looks like "MemTotal:       16318412 kB".
+		fields := strings.Fields(scan.Text())
+		if len(fields) != 3 || fields[0] != "MemTotal:" || fields[2] != "kB" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err == nil {
+			f["memory"] = strconv.FormatUint(kb*1024, 10)
+		}
+		return
+	}
+}
+
+func (f Facts) gatherUser(root fs.FS) {
+	if home, err := os.UserHomeDir(); err == nil {
+		f["home"] = home
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return
+	}
+	f.set("user", usr.Username)
+	f.set("uid", usr.Uid)
+	f.set("gid", usr.Gid)
+	f.set("shell", loginShell(root, usr.Username))
+}
+
+// loginShell returns the shell of username as listed in etc/passwd,
+// or the value of $SHELL.
+func loginShell(root fs.FS, username string) string {
+	file, err := root.Open("etc/passwd")
+	if err == nil {
+		defer file.Close()
+		scan := bufio.NewScanner(file)
+		for scan.Scan() {
+			fields := strings.Split(scan.Text(), ":")
+			if len(fields) == 7 && fields[0] == username {
+				return fields[6]
+			}
+		}
+	}
+	return os.Getenv("SHELL")
+}
+
+func (f Facts) gatherXDG() {
+	home := f["home"]
+	dirs := []struct {
+		fact, env, def string
+	}{
+		{fact: "xdg.config_home", env: "XDG_CONFIG_HOME", def: ".config"},
+		{fact: "xdg.data_home", env: "XDG_DATA_HOME", def: filepath.Join(".local", "share")},
+		{fact: "xdg.state_home", env: "XDG_STATE_HOME", def: filepath.Join(".local", "state")},
+		{fact: "xdg.cache_home", env: "XDG_CACHE_HOME", def: ".cache"},
+	}
+	for _, dir := range dirs {
+		if val := os.Getenv(dir.env); val != "" {
+			f[dir.fact] = val
+		} else if home != "" {
+			f[dir.fact] = filepath.Join(home, dir.def)
+		}
+	}
+	f.set("xdg.runtime_dir", os.Getenv("XDG_RUNTIME_DIR"))
+}
+
+// ParseOSRelease parses an os-release file, returning its variables
+// with quotes and escapes removed.
+func ParseOSRelease(r io.Reader) (map[string]string, error) {
+	vars := make(map[string]string)
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		vars[key] = unquote(val)
+	}
+	return vars, scan.Err()
+}
+
+// unquote removes shell-like quotes and backslash escapes from s.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
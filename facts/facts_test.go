@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package facts_test
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/livingsilver94/backee/facts"
+)
+
+func TestParseOSRelease(t *testing.T) {
+	const doc = `# Comment
+NAME="Fedora Linux"
+ID=fedora
+VERSION_ID=40
+PRETTY_NAME="Fedora \"Workstation\""
+`
+	rel, err := facts.ParseOSRelease(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{
+		"NAME":        "Fedora Linux",
+		"ID":          "fedora",
+		"VERSION_ID":  "40",
+		"PRETTY_NAME": `Fedora "Workstation"`,
+	}
+	if !reflect.DeepEqual(rel, expect) {
+		t.Fatalf("expected %v. Got %v", expect, rel)
+	}
+}
+
+func TestGatherFS(t *testing.T) {
+	root := fstest.MapFS{
+		"etc/os-release":            &fstest.MapFile{Data: []byte("ID=debian\nVERSION_ID=\"12\"\nID_LIKE=\"\"\n")},
+		"proc/sys/kernel/osrelease": &fstest.MapFile{Data: []byte("6.1.0-18-amd64\n")},
+		"proc/meminfo":              &fstest.MapFile{Data: []byte("MemTotal:        2048 kB\nMemFree:  1024 kB\n")},
+	}
+	f := facts.GatherFS(root)
+	expect := map[string]string{
+		"os":             runtime.GOOS,
+		"arch":           runtime.GOARCH,
+		"distro.id":      "debian",
+		"distro.version": "12",
+		"kernel":         "6.1.0-18-amd64",
+		"memory":         "2097152",
+	}
+	for name, val := range expect {
+		if f[name] != val {
+			t.Fatalf("expected fact %s to be %q. Got %q", name, val, f[name])
+		}
+	}
+	if _, ok := f["distro.like"]; ok {
+		t.Fatal("expected empty facts to be absent")
+	}
+	if vars := f.Variables(); vars[facts.Prefix+"os"] != runtime.GOOS {
+		t.Fatalf("expected variable %sos to be %q. Got %q", facts.Prefix, runtime.GOOS, vars[facts.Prefix+"os"])
+	}
+}
@@ -6,10 +6,13 @@ module github.com/livingsilver94/backee
 go 1.21
 
 require (
+	filippo.io/age v1.2.1
 	github.com/alecthomas/kong v1.4.0
 	github.com/fatih/color v1.18.0
 	github.com/hashicorp/go-set v0.1.14
 	github.com/valyala/fasttemplate v1.2.2
+	golang.org/x/crypto v0.27.0
+	golang.org/x/term v0.24.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
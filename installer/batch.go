@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package installer
+
+import "fmt"
+
+// PackageBatch defines which services have their OS packages
+// installed by the same package manager invocation.
+type PackageBatch string
+
+const (
+	// BatchNone installs the packages of each service on their own.
+	BatchNone PackageBatch = "none"
+	// BatchLevel merges the packages of services in the same dependency level.
+	// Setup scripts of the level run before packages are installed.
+	BatchLevel PackageBatch = "level"
+	// BatchAll merges the packages of all services being installed.
+	// Setup scripts of all services run before packages are installed,
+	// so a service's setup script may run before the files and
+	// finalize script of its dependencies.
+	BatchAll PackageBatch = "all"
+)
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (b *PackageBatch) UnmarshalText(text []byte) error {
+	switch batch := PackageBatch(text); batch {
+	case "", BatchNone, BatchLevel, BatchAll:
+		*b = batch
+		return nil
+	default:
+		return fmt.Errorf("invalid package batch %q", batch)
+	}
+}
@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package installer
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/livingsilver94/backee/service"
+)
+
+// Capture is a live file to be copied back into a repository.
+type Capture struct {
+	// Live is the path of the file on the system.
+	Live string
+	// Src is the path of the file in the repository.
+	Src string
+	// Content is what Src will contain.
+	Content []byte
+}
+
+// Write writes Content to Src, creating any missing parent directory.
+// If Src already exists, its permissions are kept.
+func (c Capture) Write() error {
+	err := os.MkdirAll(filepath.Dir(c.Src), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.Src, c.Content, 0644)
+}
+
+// String returns a human-readable description of the capture.
+func (c Capture) String() string {
+	return c.Live + "\t➜ " + c.Src
+}
+
+// Capture returns the live files of srv, as resolved from its links and copies,
+// that differ from their source in the repository. Values of variables used by
+// a copy's source are turned back into placeholders.
+// Live files that are missing, or symlinks that point to the repository, are skipped.
+func (inst *Installer) Capture(srv *service.Service) ([]Capture, error) {
+	err := inst.variables.InsertMany(srv.Name, srv.Variables)
+	if err != nil {
+		return nil, err
+	}
+	log := slog.Default().WithGroup(srv.Name)
+	steps := inst.Steps(srv).WithLogger(log)
+	// Nothing is written, so skipped entries are only logged.
+	steps.wri = nil
+	tmpl := NewTemplate(srv.Name, inst.variables)
+	var captures []Capture
+
+	if len(srv.Links) != 0 {
+		lnDir, err := inst.repository.LinkDir(srv.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srcFile := range sortedKeys(srv.Links) {
+			live, err := tmpl.ReplaceStringToString(srv.Links[srcFile].Path)
+			if err != nil {
+				return nil, err
+			}
+			ok, err := steps.enabled("link "+live, srv.Links[srcFile].When)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			capt, err := captureLink(live, filepath.Join(lnDir, srcFile), log)
+			if err != nil {
+				return nil, err
+			}
+			if capt != nil {
+				captures = append(captures, *capt)
+			}
+		}
+	}
+
+	if len(srv.Copies) != 0 {
+		dataDir, err := inst.repository.DataDir(srv.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srcFile := range sortedKeys(srv.Copies) {
+			live, err := tmpl.ReplaceStringToString(srv.Copies[srcFile].Path)
+			if err != nil {
+				return nil, err
+			}
+			ok, err := steps.enabled("copy "+live, srv.Copies[srcFile].When)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			if srv.Copies[srcFile].EngineFor(srcFile) == service.EngineGo {
+				log.Warn("Skipping " + live + ": Go templates cannot be captured")
+				continue
+			}
+			if strings.HasSuffix(srcFile, service.AgeExt) {
+				log.Warn("Skipping " + live + ": encrypted files cannot be captured")
+				continue
+			}
+			capt, err := captureCopy(live, filepath.Join(dataDir, srcFile), tmpl, log)
+			if err != nil {
+				return nil, err
+			}
+			if capt != nil {
+				captures = append(captures, *capt)
+			}
+		}
+	}
+	return captures, nil
+}
+
+func captureLink(live, src string, log *slog.Logger) (*Capture, error) {
+	info, err := os.Lstat(live)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Warn("Skipping missing " + live)
+			return nil, nil
+		}
+		return nil, err
+	}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := filepath.EvalSymlinks(live)
+		if err != nil || target != src {
+			log.Warn("Skipping " + live + ": it does not point to " + src)
+		}
+		return nil, nil
+	case !info.Mode().IsRegular():
+		log.Warn("Skipping " + live + ": not a regular file")
+		return nil, nil
+	}
+	cont, err := os.ReadFile(live)
+	if err != nil {
+		return nil, err
+	}
+	return newCapture(live, src, cont)
+}
+
+func captureCopy(live, src string, tmpl Template, log *slog.Logger) (*Capture, error) {
+	cont, err := os.ReadFile(live)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Warn("Skipping missing " + live)
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !isBinary(cont) {
+		orig, err := os.ReadFile(src)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		names := service.Placeholders(string(orig))
+		cont = []byte(tmpl.Unreplace(string(cont), names))
+	}
+	return newCapture(live, src, cont)
+}
+
+// newCapture returns a Capture only if src's content differs from cont.
+func newCapture(live, src string, cont []byte) (*Capture, error) {
+	orig, err := os.ReadFile(src)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil && bytes.Equal(orig, cont) {
+		return nil, nil
+	}
+	return &Capture{Live: live, Src: src, Content: cont}, nil
+}
+
+func sortedKeys(m map[string]service.FilePath) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package installer_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livingsilver94/backee/installer"
+	"github.com/livingsilver94/backee/installer/stepwriter"
+	"github.com/livingsilver94/backee/repo"
+	"github.com/livingsilver94/backee/service"
+)
+
+func TestCaptureCopy(t *testing.T) {
+	base := t.TempDir()
+	live := filepath.Join(t.TempDir(), "live.conf")
+	src := filepath.Join(base, serviceName, "data", "file.conf")
+	os.MkdirAll(filepath.Dir(src), 0755)
+	os.WriteFile(src, []byte("user={{user}}\n"), 0644)
+	os.WriteFile(live, []byte("user=admin\nadded=admin\n"), 0644)
+
+	srv := service.New(serviceName)
+	srv.Variables["user"] = service.VarValue{Kind: service.ClearText, Value: "admin"}
+	srv.Copies = map[string]service.FilePath{"file.conf": {Path: live}}
+	rep := repo.NewFS(repo.NewOSFS(base))
+	ins := installer.New(rep, stepwriter.DryRun{})
+
+	captures, err := ins.Capture(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) != 1 {
+		t.Fatalf("expected 1 capture. Got %d", len(captures))
+	}
+	const expected = "user={{user}}\nadded={{user}}\n"
+	if string(captures[0].Content) != expected {
+		t.Fatalf("expected content %q. Got %q", expected, captures[0].Content)
+	}
+	if captures[0].Src != src {
+		t.Fatalf("expected source %q. Got %q", src, captures[0].Src)
+	}
+}
+
+func TestCaptureUnchanged(t *testing.T) {
+	base := t.TempDir()
+	live := filepath.Join(t.TempDir(), "live.conf")
+	src := filepath.Join(base, serviceName, "data", "file.conf")
+	os.MkdirAll(filepath.Dir(src), 0755)
+	os.WriteFile(src, []byte("same"), 0644)
+	os.WriteFile(live, []byte("same"), 0644)
+
+	srv := service.New(serviceName)
+	srv.Copies = map[string]service.FilePath{"file.conf": {Path: live}}
+	ins := installer.New(repo.NewFS(repo.NewOSFS(base)), stepwriter.DryRun{})
+
+	captures, err := ins.Capture(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) != 0 {
+		t.Fatalf("expected no captures. Got %v", captures)
+	}
+}
+
+func TestCaptureSkippedSilent(t *testing.T) {
+	base := t.TempDir()
+	live := filepath.Join(t.TempDir(), "live.conf")
+	os.WriteFile(live, []byte("live"), 0644)
+
+	srv := service.New(serviceName)
+	srv.Copies = map[string]service.FilePath{"file.conf": {Path: live, When: `tagged("none")`}}
+	out := &strings.Builder{}
+	ins := installer.New(repo.NewFS(repo.NewOSFS(base)), stepwriter.DryRun{Dest: out})
+
+	captures, err := ins.Capture(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) != 0 {
+		t.Fatalf("expected no captures. Got %v", captures)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing printed. Got %q", out.String())
+	}
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package installer
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"slices"
+
+	"github.com/livingsilver94/backee/expr"
+	"github.com/livingsilver94/backee/facts"
+)
+
+// condition returns the Condition of entries of the service named srvName.
+// Expressions see the variables of the service and common variables.
+// Facts can also be named without their prefix.
+func (inst *Installer) condition(srvName string) Condition {
+	tmpl := NewTemplate(srvName, inst.variables)
+	env := expr.Env{
+		Lookup: func(name string) (string, bool) {
+			if val, err := tmpl.value(name); err == nil {
+				return val, true
+			}
+			if val, err := tmpl.value(facts.Prefix + name); err == nil {
+				return val, true
+			}
+			return "", false
+		},
+		Funcs: map[string]expr.Func{
+			"tagged": func(tags ...string) (bool, error) {
+				for _, tag := range tags {
+					if slices.Contains(inst.tags, tag) {
+						return true, nil
+					}
+				}
+				return false, nil
+			},
+			"command": func(names ...string) (bool, error) {
+				for _, name := range names {
+					_, err := exec.LookPath(name)
+					if err != nil {
+						return false, nil
+					}
+				}
+				return true, nil
+			},
+			"exists": func(paths ...string) (bool, error) {
+				for _, path := range paths {
+					_, err := os.Stat(path)
+					if errors.Is(err, fs.ErrNotExist) {
+						return false, nil
+					}
+					if err != nil {
+						return false, err
+					}
+				}
+				return true, nil
+			},
+		},
+	}
+	return func(when string) (bool, error) {
+		return expr.Eval(when, env)
+	}
+}
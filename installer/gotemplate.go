@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package installer
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/livingsilver94/backee/repo"
+)
+
+// maxIncludeDepth limits nested includes, to stop include loops.
+const maxIncludeDepth = 16
+
+// ExecuteGo renders text, named name, with Go's text/template package.
+// The template's dot is the map of variables visible to the service.
+// Files included by the template are looked up in dataDir,
+// and must be inside it.
+func (t Template) ExecuteGo(name, text, dataDir string, w io.Writer) (int64, error) {
+	data, err := t.variables.All(t.serviceName)
+	if err != nil {
+		return 0, err
+	}
+	cw := &countingWriter{w: w}
+	err = t.executeGo(name, text, dataDir, data, cw, 0)
+	return cw.n, err
+}
+
+func (t Template) executeGo(name, text, dataDir string, data map[string]string, w io.Writer, depth int) error {
+	funcs := template.FuncMap{
+		// var returns an empty string for unknown variables,
+		// so that they can be piped to default.
+		"var": func(name string) (string, error) {
+			val, err := t.value(name)
+			if errors.Is(err, repo.ErrNoVariable) {
+				return "", nil
+			}
+			return val, err
+		},
+		"include": func(file string) (string, error) {
+			if depth >= maxIncludeDepth {
+				return "", errors.New("too many nested includes")
+			}
+			if !filepath.IsLocal(file) {
+				return "", fmt.Errorf("including %s: path is outside the data directory", file)
+			}
+			cont, err := os.ReadFile(filepath.Join(dataDir, file))
+			if err != nil {
+				return "", err
+			}
+			buf := &strings.Builder{}
+			err = t.executeGo(file, string(cont), dataDir, data, buf, depth+1)
+			return buf.String(), err
+		},
+	}
+	for fname, fn := range templateFuncs {
+		funcs[fname] = fn
+	}
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(funcs).
+		Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, data)
+}
+
+// templateFuncs are the functions available to Go templates,
+// besides those depending on the service.
+var templateFuncs = template.FuncMap{
+	"default": func(def, val string) string {
+		if val == "" {
+			return def
+		}
+		return val
+	},
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"env":      os.Getenv,
+	"joinPath": filepath.Join,
+	"b64enc": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"sha256": func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"os":       func() string { return runtime.GOOS },
+	"arch":     func() string { return runtime.GOARCH },
+	"hostname": os.Hostname,
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("writing template output: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package installer_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/livingsilver94/backee/installer"
+	"github.com/livingsilver94/backee/repo/solver"
+	"github.com/livingsilver94/backee/service"
+)
+
+func TestExecuteGo(t *testing.T) {
+	dataDir := t.TempDir()
+	os.WriteFile(filepath.Join(dataDir, "footer.txt"), []byte("bye {{.var1}}"), 0644)
+	vars := createVariables("var1", "value1", "var2", "")
+	tmpl := installer.NewTemplate(serviceName, vars)
+
+	const text = `{{if eq os "` + runtime.GOOS + `"}}{{upper .var1}}{{end}}
+{{default "fallback" .var2}}
+{{range $k, $v := .}}{{$k}};{{end}}
+{{joinPath "/etc" "app"}} {{b64enc "hi"}}
+{{include "footer.txt"}}`
+	const expected = "VALUE1\nfallback\nvar1;var2;\n/etc/app aGk=\nbye value1"
+	out := &strings.Builder{}
+	n, err := tmpl.ExecuteGo("file.gotmpl", text, dataDir, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected {
+		t.Fatalf("expected %q. Got %q", expected, out.String())
+	}
+	if n != int64(len(expected)) {
+		t.Fatalf("expected %d bytes written. Got %d", len(expected), n)
+	}
+}
+
+func TestExecuteGoMissingVar(t *testing.T) {
+	vars := createVariables("var1", "value1")
+	tmpl := installer.NewTemplate(serviceName, vars)
+
+	_, err := tmpl.ExecuteGo("file.gotmpl", "line one\n{{.missing}}", "", &strings.Builder{})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "file.gotmpl:2:") {
+		t.Fatalf("expected the error to report file and line. Got %v", err)
+	}
+}
+
+func TestExecuteGoUndefinedVarDefault(t *testing.T) {
+	vars := createVariables("var1", "value1")
+	tmpl := installer.NewTemplate(serviceName, vars)
+
+	const expected = "value1 fallback "
+	out := &strings.Builder{}
+	_, err := tmpl.ExecuteGo("file.gotmpl", `{{var "var1" | default "x"}} {{var "missing" | default "fallback"}} {{var "parent.missing"}}`, "", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected {
+		t.Fatalf("expected %q. Got %q", expected, out.String())
+	}
+}
+
+func TestExecuteGoIncludeOutside(t *testing.T) {
+	base := t.TempDir()
+	dataDir := filepath.Join(base, "data")
+	os.Mkdir(dataDir, 0755)
+	secret := filepath.Join(base, "secret")
+	os.WriteFile(secret, []byte("s3cret"), 0644)
+	tmpl := installer.NewTemplate(serviceName, createVariables())
+
+	for _, file := range []string{"../secret", secret, "sub/../../secret"} {
+		out := &strings.Builder{}
+		_, err := tmpl.ExecuteGo("file.gotmpl", `{{include "`+filepath.ToSlash(file)+`"}}`, dataDir, out)
+		if err == nil {
+			t.Fatalf("%s: expected an error", file)
+		}
+		if strings.Contains(out.String(), "s3cret") {
+			t.Fatalf("%s: file outside the data directory included", file)
+		}
+	}
+}
+
+func TestFileCopyEngine(t *testing.T) {
+	dataDir := t.TempDir()
+	src := filepath.Join(dataDir, "conf.gotmpl")
+	os.WriteFile(src, []byte(`{{.var1}} {{"{{var1}}"}}`), 0644)
+	vars := createVariables("var1", "value1")
+	fc := installer.FileCopy{
+		Src:     src,
+		Templ:   installer.NewTemplate(serviceName, vars),
+		Engine:  service.FilePath{}.EngineFor(src),
+		DataDir: dataDir,
+	}
+	const expected = "value1 {{var1}}"
+	if s := fc.String(); s != expected {
+		t.Fatalf("expected %q. Got %q", expected, s)
+	}
+}
+
+func TestFileCopyEmpty(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "empty")
+	os.WriteFile(src, nil, 0644)
+	fc := installer.FileCopy{Src: src, Templ: installer.NewTemplate(serviceName, createVariables())}
+	if s := fc.String(); s != "" {
+		t.Fatalf("expected empty content. Got %q", s)
+	}
+}
+
+func TestFileCopyEncrypted(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := solver.Encrypt("machine example.com password {{.var1}}", id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDir := t.TempDir()
+	src := filepath.Join(dataDir, "netrc.gotmpl"+service.AgeExt)
+	os.WriteFile(src, []byte(enc), 0600)
+	fc := installer.FileCopy{
+		Src:     src,
+		Templ:   installer.NewTemplate(serviceName, createVariables("var1", "value1")),
+		Engine:  service.FilePath{}.EngineFor(src),
+		DataDir: dataDir,
+	}
+	_, err = fc.WriteTo(&strings.Builder{})
+	if !errors.Is(err, installer.ErrNoDecrypter) {
+		t.Fatalf("expected %v. Got %v", installer.ErrNoDecrypter, err)
+	}
+
+	fc.Decrypter = solver.NewAge(id)
+	out := &strings.Builder{}
+	_, err = fc.WriteTo(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = "machine example.com password value1"
+	if out.String() != expected {
+		t.Fatalf("expected %q. Got %q", expected, out.String())
+	}
+	if s := fc.String(); s != "*encrypted*" {
+		t.Fatalf("expected the content to be hidden. Got %q", s)
+	}
+}
@@ -4,8 +4,16 @@
 package installer
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/livingsilver94/backee/pkgmanager"
 	"github.com/livingsilver94/backee/repo"
 	"github.com/livingsilver94/backee/repo/solver"
 	"github.com/livingsilver94/backee/service"
@@ -17,6 +25,22 @@ type Installer struct {
 
 	variables repo.Variables
 	list      List
+	manifest  *Manifest
+	conflict  service.ConflictPolicy
+	batch     PackageBatch
+	// pkgManager installs packages of services
+	// that don't define a package manager command.
+	pkgManager pkgmanager.PackageManager
+	// noPackages skips the installation of packages.
+	noPackages bool
+	// decrypter decrypts copied files encrypted with age.
+	decrypter Decrypter
+
+	jobs int
+	// tags are the variants of the host, checked by conditions.
+	tags []string
+	// flushMu serializes the flushing of buffered logs.
+	flushMu *sync.Mutex
 }
 
 func New(repository repo.Repo, sw StepWriter, options ...Option) Installer {
@@ -25,6 +49,8 @@ func New(repository repo.Repo, sw StepWriter, options ...Option) Installer {
 		writer:     sw,
 		variables:  repo.NewVariables(),
 		list:       NewList(),
+		jobs:       1,
+		flushMu:    &sync.Mutex{},
 	}
 	i.variables.RegisterSolver(service.Datadir, solver.NewDatadir(repository))
 	for _, option := range options {
@@ -42,44 +68,361 @@ func (inst *Installer) Install(srv *service.Service) error {
 	if err != nil {
 		return err
 	}
-	for level := depGraph.Depth() - 1; level >= 0; level-- {
-		depGraph.Level(level).ForEach(func(dep *service.Service) bool {
-			err = inst.InstallSingle(dep)
-			return err == nil
+	return inst.installLevels(append(levels(depGraph), []*service.Service{srv}))
+}
+
+// InstallMany installs srvs and their dependencies as if they were
+// the dependencies of a single service. Unlike calling Install for each of srvs,
+// services that don't depend on each other may be installed concurrently.
+func (inst *Installer) InstallMany(srvs []*service.Service) error {
+	deps := service.NewDepSet(len(srvs))
+	for _, srv := range srvs {
+		deps.Insert(srv.Name)
+	}
+	depGraph, err := inst.repository.ResolveDeps(&service.Service{Depends: &deps})
+	if err != nil {
+		return err
+	}
+	return inst.installLevels(levels(depGraph))
+}
+
+// installLevels installs lvls in order, batching packages
+// as configured.
+func (inst *Installer) installLevels(lvls [][]*service.Service) error {
+	switch inst.batch {
+	case BatchAll:
+		return inst.installBatch(lvls)
+	case BatchLevel:
+		for _, lvl := range lvls {
+			err := inst.installBatch([][]*service.Service{lvl})
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		for _, lvl := range lvls {
+			err := inst.installLevel(lvl, inst.installSingle)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// installBatch installs lvls in three phases: setup scripts of all services,
+// then their packages with as few package manager invocations as possible,
+// then the remaining steps. Each phase follows the order of lvls, but setup
+// scripts of a level run before the remaining steps of the previous levels.
+func (inst *Installer) installBatch(lvls [][]*service.Service) error {
+	var (
+		records = make(map[string]*ServiceRecord)
+		pending []*service.Service
+		mu      sync.Mutex
+	)
+	for _, lvl := range lvls {
+		err := inst.installLevel(lvl, func(srv *service.Service, steps Steps) error {
+			if inst.IsInstalled(srv.Name) {
+				steps.log.Info("Already installed")
+				return nil
+			}
+			err := inst.variables.InsertMany(srv.Name, srv.Variables)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			records[srv.Name] = &ServiceRecord{}
+			mu.Unlock()
+			return steps.Setup()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, lvl := range lvls {
+		for _, srv := range lvl {
+			if _, ok := records[srv.Name]; ok {
+				pending = append(pending, srv)
+			}
+		}
+	}
+	err := inst.installPackages(pending)
+	if err != nil {
+		return err
+	}
+	for _, lvl := range lvls {
+		err := inst.installLevel(lvl, func(srv *service.Service, steps Steps) error {
+			rec, ok := records[srv.Name]
+			if !ok {
+				return nil
+			}
+			err := inst.runFileSteps(steps.WithRecord(rec))
+			if err != nil {
+				return err
+			}
+			return inst.markInstalled(srv.Name, rec)
 		})
 		if err != nil {
 			return err
 		}
 	}
-	return inst.InstallSingle(srv)
+	return nil
+}
+
+// installLevel runs install for services that don't depend on each other,
+// using up to inst.jobs workers. When there is more than one worker,
+// logs of each service are held back and printed together.
+// No new service is installed after the first failure.
+func (inst *Installer) installLevel(srvs []*service.Service, install installFunc) error {
+	workers := min(inst.jobs, len(srvs))
+	if workers <= 1 {
+		for _, srv := range srvs {
+			err := install(srv, inst.Steps(srv))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		queue  = make(chan *service.Service)
+		errs   = make([]error, workers)
+		failed atomic.Bool
+		wg     sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for srv := range queue {
+				err := inst.installBuffered(srv, install)
+				if err != nil {
+					errs[w] = errors.Join(errs[w], err)
+					failed.Store(true)
+				}
+			}
+		}(w)
+	}
+	for _, srv := range srvs {
+		if failed.Load() {
+			break
+		}
+		queue <- srv
+	}
+	close(queue)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// installFunc installs a single service with steps.
+type installFunc func(srv *service.Service, steps Steps) error
+
+// installBuffered runs install for srv while holding back its logs
+// and the output of the StepWriter, which are printed all at once when done.
+func (inst *Installer) installBuffered(srv *service.Service, install installFunc) error {
+	handler := newBufferedHandler(slog.Default().Handler())
+	steps := inst.Steps(srv).
+		WithLogger(slog.New(handler).WithGroup(srv.Name)).
+		withOutput(handler.output)
+	err := install(srv, steps)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", srv.Name, err)
+	}
+	inst.flushMu.Lock()
+	defer inst.flushMu.Unlock()
+	return errors.Join(err, handler.flush())
+}
+
+// installPackages installs the packages of srvs, merging those of services
+// that share the same package manager. If a merged invocation fails,
+// packages are installed again service by service to find the culprits.
+func (inst *Installer) installPackages(srvs []*service.Service) error {
+	if inst.noPackages {
+		return nil
+	}
+	var (
+		groups  = make(map[string][]*service.Service)
+		pkgs    = make(map[string][]service.Package)
+		cmdKeys []string
+	)
+	for _, srv := range srvs {
+		if len(srv.Packages) == 0 {
+			continue
+		}
+		srvPkgs, err := inst.Steps(srv).packages()
+		if err != nil {
+			return fmt.Errorf("%s: %w", srv.Name, err)
+		}
+		if len(srvPkgs) == 0 {
+			continue
+		}
+		// Services without a package manager command share the driver.
+		key := strings.Join(srv.PkgManager, "\x00")
+		if _, ok := groups[key]; !ok {
+			cmdKeys = append(cmdKeys, key)
+		}
+		groups[key] = append(groups[key], srv)
+		pkgs[key] = append(pkgs[key], srvPkgs...)
+	}
+	for _, key := range cmdKeys {
+		group := groups[key]
+		names := make([]string, 0, len(group))
+		for _, srv := range group {
+			names = append(names, srv.Name)
+		}
+		fullCmd, err := packageCommand(inst.pkgManager, group[0].PkgManager, pkgs[key])
+		if err != nil {
+			return err
+		}
+		if fullCmd == nil {
+			slog.Info("OS packages of " + strings.Join(names, ", ") + " already installed")
+			continue
+		}
+		slog.Info("Installing OS packages of " + strings.Join(names, ", "))
+		err = inst.writer.InstallPackages(fullCmd)
+		if err == nil {
+			continue
+		}
+		if len(group) == 1 {
+			return fmt.Errorf("%s: %w", group[0].Name, err)
+		}
+		slog.Warn("Merged package installation failed, retrying service by service", "err", err)
+		var errs []error
+		for _, srv := range group {
+			err := inst.Steps(srv).InstallPackages()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", srv.Name, err))
+			}
+		}
+		if len(errs) != 0 {
+			return errors.Join(errs...)
+		}
+	}
+	return nil
 }
 
 func (inst *Installer) InstallSingle(srv *service.Service) error {
-	if inst.list.Contains(srv.Name) {
-		slog.Default().WithGroup(srv.Name).Info("Already installed")
+	return inst.installSingle(srv, inst.Steps(srv))
+}
+
+func (inst *Installer) installSingle(srv *service.Service, steps Steps) error {
+	if inst.IsInstalled(srv.Name) {
+		steps.log.Info("Already installed")
 		return nil
 	}
 	err := inst.variables.InsertMany(srv.Name, srv.Variables)
 	if err != nil {
 		return err
 	}
-	err = inst.runAllSteps(srv)
+	rec := ServiceRecord{}
+	err = inst.runAllSteps(steps.WithRecord(&rec))
 	if err != nil {
 		return err
 	}
-	inst.list.Insert(srv.Name)
+	return inst.markInstalled(srv.Name, &rec)
+}
+
+// markInstalled adds the service named name to the installation list,
+// and to the manifest along with rec.
+func (inst *Installer) markInstalled(name string, rec *ServiceRecord) error {
+	inst.list.Insert(name)
+	if inst.manifest != nil {
+		rec.InstalledAt = time.Now().UTC()
+		inst.manifest.Set(name, *rec)
+		return inst.manifest.Save()
+	}
 	return nil
 }
 
-func (inst *Installer) Steps(srv *service.Service) Steps {
-	return NewSteps(srv, inst.writer)
+// IsInstalled returns whether the service named name was installed.
+// The manifest, if any, is authoritative over the installation list.
+func (inst *Installer) IsInstalled(name string) bool {
+	if inst.manifest != nil {
+		return inst.manifest.Contains(name)
+	}
+	return inst.list.Contains(name)
 }
 
-func (inst *Installer) runAllSteps(srv *service.Service) error {
+// Uninstall reverts the steps of srv, if it was installed.
+// Dependents of srv are not taken into account.
+// When the manifest records the files written for srv, those are removed.
+// Otherwise, files are guessed from srv's current definition.
+func (inst *Installer) Uninstall(srv *service.Service) error {
+	if !inst.IsInstalled(srv.Name) {
+		slog.Default().WithGroup(srv.Name).Info("Not installed")
+		return nil
+	}
+	err := inst.variables.InsertMany(srv.Name, srv.Variables)
+	if err != nil {
+		return err
+	}
 	steps := inst.Steps(srv)
 	list := []func() error{
-		func() error { return steps.Setup() },
-		func() error { return steps.InstallPackages() },
+		func() error { return steps.Uninstall(inst.variables) },
+	}
+	if rec, ok := inst.recorded(srv.Name); ok {
+		list = append(list, func() error { return steps.RemoveRecorded(rec) })
+	} else {
+		list = append(list,
+			func() error { return steps.RemoveCopies(inst.repository, inst.variables) },
+			func() error { return steps.UnlinkFiles(inst.repository, inst.variables) },
+		)
+	}
+	for _, step := range list {
+		err := step()
+		if err != nil {
+			return err
+		}
+	}
+	err = inst.list.Remove(srv.Name)
+	if err != nil {
+		return err
+	}
+	if inst.manifest != nil {
+		inst.manifest.Remove(srv.Name)
+		return inst.manifest.Save()
+	}
+	return nil
+}
+
+// recorded returns the manifest record of the service named name,
+// if it lists any file.
+func (inst *Installer) recorded(name string) (ServiceRecord, bool) {
+	if inst.manifest == nil {
+		return ServiceRecord{}, false
+	}
+	rec, ok := inst.manifest.Record(name)
+	return rec, ok && len(rec.Files) != 0
+}
+
+func (inst *Installer) Steps(srv *service.Service) Steps {
+	steps := NewSteps(srv, inst.writer).
+		WithConflictPolicy(inst.conflict).
+		WithPackageManager(inst.pkgManager).
+		WithDecrypter(inst.decrypter).
+		WithCondition(inst.condition(srv.Name))
+	if inst.noPackages {
+		steps = steps.WithoutPackages()
+	}
+	return steps
+}
+
+func (inst *Installer) runAllSteps(steps Steps) error {
+	err := steps.Setup()
+	if err != nil {
+		return err
+	}
+	err = steps.InstallPackages()
+	if err != nil {
+		return err
+	}
+	return inst.runFileSteps(steps)
+}
+
+// runFileSteps runs the steps that follow the installation of packages.
+func (inst *Installer) runFileSteps(steps Steps) error {
+	list := []func() error{
 		func() error { return steps.LinkFiles(inst.repository, inst.variables) },
 		func() error { return steps.CopyFiles(inst.repository, inst.variables) },
 		func() error { return steps.Finalize(inst.variables) },
@@ -93,6 +436,26 @@ func (inst *Installer) runAllSteps(srv *service.Service) error {
 	return nil
 }
 
+// levels lists the services of depGraph from the deepest level, sorted by name.
+// Services are dropped from a level if they already appeared in a deeper one.
+func levels(depGraph repo.DepGraph) [][]*service.Service {
+	seen := make(map[string]struct{})
+	lvls := make([][]*service.Service, 0, depGraph.Depth())
+	for level := depGraph.Depth() - 1; level >= 0; level-- {
+		var lvl []*service.Service
+		for _, srv := range depGraph.Level(level).Slice() {
+			if _, ok := seen[srv.Name]; ok {
+				continue
+			}
+			seen[srv.Name] = struct{}{}
+			lvl = append(lvl, srv)
+		}
+		slices.SortFunc(lvl, func(a, b *service.Service) int { return strings.Compare(a.Name, b.Name) })
+		lvls = append(lvls, lvl)
+	}
+	return lvls
+}
+
 type Option func(*Installer)
 
 func WithCommonVars(vars map[string]string) Option {
@@ -109,12 +472,75 @@ func WithVarSolvers(solvs map[service.VarKind]repo.VarSolver) Option {
 	}
 }
 
+// WithDecrypter sets the Decrypter of copied files encrypted with age.
+func WithDecrypter(dec Decrypter) Option {
+	return func(i *Installer) {
+		i.decrypter = dec
+	}
+}
+
 func WithList(li List) Option {
 	return func(i *Installer) {
 		i.list = li
 	}
 }
 
+// WithManifest sets the manifest where installed files are recorded.
+// When set, it determines whether a service is installed in place of the List.
+func WithManifest(man *Manifest) Option {
+	return func(i *Installer) {
+		i.manifest = man
+	}
+}
+
+// WithTags sets the variant tags of the host,
+// which conditions check with the tagged function.
+func WithTags(tags []string) Option {
+	return func(i *Installer) {
+		i.tags = tags
+	}
+}
+
+// WithJobs sets how many services of the same dependency level
+// may be installed concurrently. It defaults to 1.
+func WithJobs(jobs int) Option {
+	return func(i *Installer) {
+		i.jobs = max(jobs, 1)
+	}
+}
+
+// WithPackageManager sets the package manager driver for services
+// that don't define a package manager command.
+func WithPackageManager(pm pkgmanager.PackageManager) Option {
+	return func(i *Installer) {
+		i.pkgManager = pm
+	}
+}
+
+// WithoutPackages skips the installation of OS packages,
+// for StepWriters that only inspect files, such as drift checks.
+func WithoutPackages() Option {
+	return func(i *Installer) {
+		i.noPackages = true
+	}
+}
+
+// WithPackageBatch sets how OS packages of different services
+// are merged into a single package manager invocation.
+func WithPackageBatch(batch PackageBatch) Option {
+	return func(i *Installer) {
+		i.batch = batch
+	}
+}
+
+// WithConflictPolicy sets the policy for links and copies
+// whose destination exists, unless they specify their own.
+func WithConflictPolicy(policy service.ConflictPolicy) Option {
+	return func(i *Installer) {
+		i.conflict = policy
+	}
+}
+
 func WithStepWriter(sw StepWriter) Option {
 	return func(i *Installer) {
 		i.writer = sw
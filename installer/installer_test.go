@@ -0,0 +1,519 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package installer_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/livingsilver94/backee/expr"
+	"github.com/livingsilver94/backee/installer"
+	"github.com/livingsilver94/backee/installer/stepwriter"
+	"github.com/livingsilver94/backee/redact"
+	"github.com/livingsilver94/backee/repo"
+	"github.com/livingsilver94/backee/repo/solver"
+	"github.com/livingsilver94/backee/service"
+)
+
+func TestInstallManyParallel(t *testing.T) {
+	rep := writeRepo(t, map[string]string{
+		"a":    "",
+		"b":    "",
+		"c":    "depends: [a]",
+		"root": "depends: [a, b, c]",
+	})
+	root, err := rep.Service("root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := installer.NewList()
+	ins := installer.New(rep, stepwriter.DryRun{}, installer.WithList(list), installer.WithJobs(4))
+	err = ins.InstallMany([]*service.Service{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := list.Names()
+	slices.Sort(names)
+	expected := []string{"a", "b", "c", "root"}
+	if !slices.Equal(names, expected) {
+		t.Fatalf("expected installed services %v. Got %v", expected, names)
+	}
+}
+
+func TestInstallManyParallelFailure(t *testing.T) {
+	// A valid kind, but without a solver.
+	rep := writeRepo(t, map[string]string{
+		"ok":   "",
+		"bad":  "variables:\n  key:\n    kind: pass\n    value: v",
+		"root": "depends: [ok, bad]",
+	})
+	root, err := rep.Service("root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := installer.NewList()
+	ins := installer.New(rep, stepwriter.DryRun{}, installer.WithList(list), installer.WithJobs(2))
+	err = ins.InstallMany([]*service.Service{root})
+	if err == nil || !strings.HasPrefix(err.Error(), "bad: ") {
+		t.Fatalf("expected an error from service bad. Got %v", err)
+	}
+	if slices.Contains(list.Names(), "root") {
+		t.Fatal("expected root not to be installed after a dependency failed")
+	}
+}
+
+func TestInstallManyParallelOutput(t *testing.T) {
+	names := []string{"a", "b", "c", "d"}
+	srvs := make(map[string]string)
+	for _, name := range names {
+		var copies strings.Builder
+		for i := 0; i < 20; i++ {
+			fmt.Fprintf(&copies, "\n  f%d: /dst/%s%d", i, name, i)
+		}
+		srvs[name] = "copies:" + copies.String()
+	}
+	rep := writeRepo(t, srvs)
+	var previews []string
+	for _, name := range names {
+		dataDir, _ := rep.DataDir(name)
+		os.Mkdir(dataDir, 0755)
+		for i := 0; i < 20; i++ {
+			os.WriteFile(filepath.Join(dataDir, fmt.Sprintf("f%d", i)), []byte(fmt.Sprintf("%s%d", name, i)), 0644)
+			previews = append(previews, fmt.Sprintf("Will write \"/dst/%s%d\" with the following content:\n%s%d\n", name, i, name, i))
+		}
+	}
+	all, err := rep.AllServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &syncBuffer{}
+	ins := installer.New(rep, stepwriter.DryRun{Dest: out}, installer.WithJobs(4))
+	err = ins.InstallMany(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, preview := range previews {
+		if !strings.Contains(out.String(), preview) {
+			t.Fatalf("expected preview %q in one piece. Got\n%s", preview, out)
+		}
+	}
+}
+
+func TestInstallManyBatchLevel(t *testing.T) {
+	rep := writeRepo(t, map[string]string{
+		"a":    "packages: [pkg1, pkg2]\npkgmanager: [pm, install]",
+		"b":    "packages: [pkg2, pkg3]\npkgmanager: [pm, install]",
+		"c":    "packages: [other]\npkgmanager: [pm2]",
+		"root": "depends: [a, b, c]\npackages: [pkg4]\npkgmanager: [pm, install]",
+	})
+	root, err := rep.Service("root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wri := &pkgWriter{}
+	ins := installer.New(rep, wri, installer.WithPackageBatch(installer.BatchLevel))
+	err = ins.InstallMany([]*service.Service{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"pm install pkg1 pkg2 pkg3", "pm2 other", "pm install pkg4"}
+	if !slices.Equal(wri.cmds, expected) {
+		t.Fatalf("expected commands %q. Got %q", expected, wri.cmds)
+	}
+}
+
+func TestInstallManyBatchFailure(t *testing.T) {
+	rep := writeRepo(t, map[string]string{
+		"a": "packages: [pkg1]\npkgmanager: [pm]",
+		"b": "packages: [broken]\npkgmanager: [pm]",
+	})
+	srvs, err := rep.AllServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wri := &pkgWriter{}
+	list := installer.NewList()
+	ins := installer.New(rep, wri, installer.WithList(list), installer.WithPackageBatch(installer.BatchAll))
+	err = ins.InstallMany(srvs)
+	if err == nil || !strings.HasPrefix(err.Error(), "b: ") {
+		t.Fatalf("expected an error from service b. Got %v", err)
+	}
+	expected := []string{"pm pkg1 broken", "pm pkg1", "pm broken"}
+	if !slices.Equal(wri.cmds, expected) {
+		t.Fatalf("expected commands %q. Got %q", expected, wri.cmds)
+	}
+	if len(list.Names()) != 0 {
+		t.Fatalf("expected no installed service. Got %v", list.Names())
+	}
+}
+
+func TestInstallManyBatchAllOrder(t *testing.T) {
+	rep := writeRepo(t, map[string]string{
+		"a": "setup: setup a\npackages: [pkga]\npkgmanager: [pm]\nfinalize: finalize a",
+		"b": "depends: [a]\nsetup: setup b\npackages: [pkgb]\npkgmanager: [pm]\nfinalize: finalize b",
+	})
+	b, err := rep.Service("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wri := &pkgWriter{}
+	ins := installer.New(rep, wri, installer.WithPackageBatch(installer.BatchAll))
+	err = ins.Install(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Setup scripts of dependents run before the finalizers of their dependencies.
+	expected := []string{"setup a", "setup b", "pm pkga pkgb", "finalize a", "finalize b"}
+	if !slices.Equal(wri.cmds, expected) {
+		t.Fatalf("expected steps %q. Got %q", expected, wri.cmds)
+	}
+}
+
+func TestInstallPackageManager(t *testing.T) {
+	rep := writeRepo(t, map[string]string{
+		"a": "packages: [vim, {name: fd, names: {fake: fd-find}}]",
+		"b": "packages: [zsh]",
+	})
+	srvs, err := rep.AllServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wri := &pkgWriter{}
+	pm := fakeManager{installed: []string{"vim", "zsh"}}
+	ins := installer.New(rep, wri, installer.WithPackageManager(pm))
+	err = ins.InstallMany(srvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"fake fd-find"}
+	if !slices.Equal(wri.cmds, expected) {
+		t.Fatalf("expected commands %q. Got %q", expected, wri.cmds)
+	}
+}
+
+func TestInstallNoPackageManager(t *testing.T) {
+	rep := writeRepo(t, map[string]string{"a": "packages: [vim]"})
+	srv, err := rep.Service("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins := installer.New(rep, &pkgWriter{})
+	err = ins.Install(srv)
+	if !errors.Is(err, installer.ErrNoPkgManager) {
+		t.Fatalf("expected %v. Got %v", installer.ErrNoPkgManager, err)
+	}
+}
+
+func TestInstallDiffWithoutPackageManager(t *testing.T) {
+	live := filepath.Join(t.TempDir(), "vimrc")
+	rep := writeRepo(t, map[string]string{"a": fmt.Sprintf(`
+packages: [vim]
+copies:
+  vimrc: %s`, live)})
+	dataDir, _ := rep.DataDir("a")
+	os.Mkdir(dataDir, 0755)
+	os.WriteFile(filepath.Join(dataDir, "vimrc"), []byte("set number\n"), 0644)
+	srv, err := rep.Service("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wri := &stepwriter.Diff{Dest: io.Discard}
+	ins := installer.New(rep, wri, installer.WithoutPackages())
+	err = ins.Install(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wri.Drifts != 1 {
+		t.Fatalf("expected 1 drift. Got %d", wri.Drifts)
+	}
+}
+
+func TestInstallConditions(t *testing.T) {
+	rep := writeRepo(t, map[string]string{"a": `
+pkgmanager: [pm]
+variables:
+  role: desktop
+packages:
+  - vim
+  - {name: steam, when: role == "server"}
+  - {name: tlp, when: tagged("laptop")}
+  - {name: fd, when: 'os == "linux" && !defined("nothing")'}`})
+	srv, err := rep.Service("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wri := &pkgWriter{}
+	ins := installer.New(rep, wri,
+		installer.WithCommonVars(map[string]string{"facts.os": "linux"}),
+		installer.WithTags([]string{"laptop"}),
+	)
+	err = ins.Install(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"pm vim tlp fd"}
+	if !slices.Equal(wri.cmds, expected) {
+		t.Fatalf("expected commands %q. Got %q", expected, wri.cmds)
+	}
+}
+
+func TestInstallConditionUndefined(t *testing.T) {
+	rep := writeRepo(t, map[string]string{"a": `
+pkgmanager: [pm]
+packages: [{name: vim, when: 'nothing == "x"'}]`})
+	srv, err := rep.Service("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins := installer.New(rep, &pkgWriter{})
+	err = ins.Install(srv)
+	if !errors.Is(err, expr.ErrUndefined) {
+		t.Fatalf("expected %v. Got %v", expr.ErrUndefined, err)
+	}
+}
+
+func TestInstallValidated(t *testing.T) {
+	rep := writeRepo(t, map[string]string{
+		"base": "variables: {port: 80}",
+		"ok":   "depends: [base]\nvariables: {user: me}\nfinalize: echo {{user}}",
+		"bad":  "depends: [base]\nfinalize: echo {{base.port}}",
+	})
+	for name, valid := range map[string]bool{"ok": true, "bad": false} {
+		diags := rep.Validate(name, nil)
+		if valid != (len(diags) == 0) {
+			t.Fatalf("%s: unexpected problems %v", name, diags)
+		}
+		srv, err := rep.Service(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ins := installer.New(rep, stepwriter.DryRun{Dest: io.Discard})
+		err = ins.Install(srv)
+		if valid != (err == nil) {
+			t.Fatalf("%s: validation and installation disagree. Got %v", name, err)
+		}
+	}
+}
+
+func TestInstallDryRunRedacted(t *testing.T) {
+	const secret = "s3cr3t-p4ss"
+	rep := writeRepo(t, map[string]string{"a": `
+variables:
+  pass: {kind: exec, value: vault:db}
+copies:
+  conf: /etc/app.conf
+finalize: echo password={{pass}}`})
+	dataDir, _ := rep.DataDir("a")
+	os.Mkdir(dataDir, 0755)
+	os.WriteFile(filepath.Join(dataDir, "conf"), []byte("password = {{pass}}\n"), 0644)
+	srv, err := rep.Service("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	read, write, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = write
+	ins := installer.New(rep, stepwriter.DryRun{},
+		installer.WithVarSolvers(map[service.VarKind]repo.VarSolver{solver.ExecKind: fixedSolver(secret)}))
+	err = ins.Install(srv)
+	os.Stdout = stdout
+	write.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := io.ReadAll(read)
+	if strings.Contains(string(out), secret) {
+		t.Fatalf("secret printed in dry run:\n%s", out)
+	}
+	if !strings.Contains(string(out), "password = "+redact.Mask) || !strings.Contains(string(out), "password="+redact.Mask) {
+		t.Fatalf("expected masked secrets in dry run:\n%s", out)
+	}
+}
+
+func TestUninstallCopiesWithoutManifest(t *testing.T) {
+	live := t.TempDir()
+	rep := writeRepo(t, map[string]string{"a": fmt.Sprintf(`
+variables:
+  user: admin
+copies:
+  same.conf: %s/same.conf
+  edited.conf: %s/edited.conf`, live, live)})
+	dataDir, _ := rep.DataDir("a")
+	os.Mkdir(dataDir, 0755)
+	os.WriteFile(filepath.Join(dataDir, "same.conf"), []byte("user={{user}}\n"), 0644)
+	os.WriteFile(filepath.Join(dataDir, "edited.conf"), []byte("user={{user}}\n"), 0644)
+	os.WriteFile(filepath.Join(live, "same.conf"), []byte("user=admin\n"), 0644)
+	os.WriteFile(filepath.Join(live, "edited.conf"), []byte("user=admin\nedited=true\n"), 0644)
+	srv, err := rep.Service("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := installer.NewList()
+	list.Insert("a")
+	ins := installer.New(rep, stepwriter.OS{}, installer.WithList(list))
+	err = ins.Uninstall(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(live, "same.conf")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the unchanged copy to be removed. Got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(live, "edited.conf")); err != nil {
+		t.Fatalf("expected the edited copy to be kept. Got %v", err)
+	}
+}
+
+func TestInstallUntouchedNotRecorded(t *testing.T) {
+	live := filepath.Join(t.TempDir(), "foreign.conf")
+	os.WriteFile(live, []byte("foreign\n"), 0644)
+	rep := writeRepo(t, map[string]string{"a": fmt.Sprintf(`
+copies:
+  foreign.conf: {path: %s, conflict: skip}`, live)})
+	dataDir, _ := rep.DataDir("a")
+	os.Mkdir(dataDir, 0755)
+	os.WriteFile(filepath.Join(dataDir, "foreign.conf"), []byte("ours\n"), 0644)
+	srv, err := rep.Service("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	man := installer.NewManifest()
+	ins := installer.New(rep, stepwriter.OS{}, installer.WithList(installer.NewList()), installer.WithManifest(man))
+	err = ins.Install(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, ok := man.Record("a")
+	if !ok {
+		t.Fatal("expected service a to be in the manifest")
+	}
+	if len(rec.Files) != 0 {
+		t.Fatalf("expected no recorded file. Got %v", rec.Files)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes.
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestUninstallCopiesMissingSource(t *testing.T) {
+	live := t.TempDir()
+	rep := writeRepo(t, map[string]string{"a": fmt.Sprintf(`
+copies:
+  present.conf: %s/present.conf
+  gone.conf: %s/gone.conf`, live, live)})
+	dataDir, _ := rep.DataDir("a")
+	os.Mkdir(dataDir, 0755)
+	os.WriteFile(filepath.Join(dataDir, "present.conf"), []byte("present\n"), 0644)
+	os.WriteFile(filepath.Join(live, "present.conf"), []byte("present\n"), 0644)
+	os.WriteFile(filepath.Join(live, "gone.conf"), []byte("gone\n"), 0644)
+	srv, err := rep.Service("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := installer.NewList()
+	list.Insert("a")
+	ins := installer.New(rep, stepwriter.OS{}, installer.WithList(list))
+	err = ins.Uninstall(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(live, "present.conf")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the copy with a source to be removed. Got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(live, "gone.conf")); err != nil {
+		t.Fatalf("expected the copy without a source to be kept. Got %v", err)
+	}
+}
+
+// fixedSolver solves all variables to its value.
+type fixedSolver string
+
+func (s fixedSolver) Value(string) (string, error) {
+	return string(s), nil
+}
+
+// fakeManager is a package manager where installed are already installed.
+type fakeManager struct {
+	installed []string
+}
+
+func (fakeManager) Name() string {
+	return "fake"
+}
+
+func (m fakeManager) Installed(pkgs []string) ([]string, error) {
+	var installed []string
+	for _, pkg := range pkgs {
+		if slices.Contains(m.installed, pkg) {
+			installed = append(installed, pkg)
+		}
+	}
+	return installed, nil
+}
+
+func (fakeManager) InstallCommand(pkgs []string) []string {
+	return append([]string{"fake"}, pkgs...)
+}
+
+// pkgWriter records package manager invocations, and fails those
+// containing a package named "broken". Scripts are recorded too.
+type pkgWriter struct {
+	stepwriter.DryRun
+	cmds []string
+}
+
+func (w *pkgWriter) Setup(script string) error {
+	w.cmds = append(w.cmds, script)
+	return nil
+}
+
+func (w *pkgWriter) Finalize(script string) error {
+	w.cmds = append(w.cmds, script)
+	return nil
+}
+
+func (w *pkgWriter) InstallPackages(fullCmd []string) error {
+	w.cmds = append(w.cmds, strings.Join(fullCmd, " "))
+	if slices.Contains(fullCmd, "broken") {
+		return errors.New("package not found")
+	}
+	return nil
+}
+
+// writeRepo creates a repository with a service.yaml for each of services.
+func writeRepo(t *testing.T, services map[string]string) repo.FS {
+	base := t.TempDir()
+	for name, yml := range services {
+		os.Mkdir(filepath.Join(base, name), 0755)
+		os.WriteFile(filepath.Join(base, name, "service.yaml"), []byte(yml), 0644)
+	}
+	return repo.NewFS(repo.NewOSFS(base))
+}
@@ -5,35 +5,48 @@ package installer
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/hashicorp/go-set"
 )
 
+// List is the list of installed services. It is safe for concurrent use.
 type List struct {
 	installed *set.Set[string]
 	cache     io.Writer
+	mu        *sync.Mutex
 }
 
 func NewList() List {
 	return List{
 		installed: set.New[string](10),
+		mu:        &sync.Mutex{},
 	}
 }
 
-func NewListCached(cache io.ReadWriter) (List, error) {
+// NewListFrom returns a List populated with the names read from r.
+// Insertions and removals will not be reflected on r.
+func NewListFrom(r io.Reader) (List, error) {
 	list := NewList()
-	list.cache = cache
-
-	scan := bufio.NewScanner(cache)
+	scan := bufio.NewScanner(r)
 	for scan.Scan() {
 		list.installed.Insert(scan.Text())
 	}
 	return list, scan.Err()
 }
 
+func NewListCached(cache io.ReadWriter) (List, error) {
+	list, err := NewListFrom(cache)
+	list.cache = cache
+	return list, err
+}
+
 func (il *List) Insert(name string) error {
+	il.mu.Lock()
+	defer il.mu.Unlock()
 	var err error
 	if il.cache != nil {
 		_, err = fmt.Fprintf(il.cache, "\n"+name)
@@ -42,10 +55,56 @@ func (il *List) Insert(name string) error {
 	return err
 }
 
+// Remove removes name from the list. If the list is cached,
+// the cache is rewritten from scratch, which requires it to be truncatable.
+func (il *List) Remove(name string) error {
+	il.mu.Lock()
+	defer il.mu.Unlock()
+	if !il.installed.Remove(name) || il.cache == nil {
+		return nil
+	}
+	cache, ok := il.cache.(truncater)
+	if !ok {
+		return errors.New("installation list cache cannot be rewritten")
+	}
+	err := cache.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = cache.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	for _, name := range il.installed.Slice() {
+		_, err = fmt.Fprint(il.cache, "\n"+name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (il *List) Contains(name string) bool {
+	il.mu.Lock()
+	defer il.mu.Unlock()
 	return il.installed.Contains(name)
 }
 
+// Names returns the names in the list, in no particular order.
+func (il *List) Names() []string {
+	il.mu.Lock()
+	defer il.mu.Unlock()
+	return il.installed.Slice()
+}
+
 func (il *List) Size() int {
+	il.mu.Lock()
+	defer il.mu.Unlock()
 	return il.installed.Size()
 }
+
+// truncater is a cache that can be emptied and rewritten.
+type truncater interface {
+	io.Seeker
+	Truncate(size int64) error
+}
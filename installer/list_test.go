@@ -6,6 +6,7 @@ package installer_test
 import (
 	"bytes"
 	"io"
+	"os"
 	"strings"
 	"testing"
 
@@ -57,3 +58,35 @@ func TestListInsertCached(t *testing.T) {
 		}
 	}
 }
+
+func TestListRemoveCached(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	_, err = file.WriteString("service1\nservice2\nservice3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Seek(0, io.SeekStart)
+
+	list, err := installer.NewListCached(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = list.Remove("service2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Contains("service2") {
+		t.Fatalf("list still contains %q", "service2")
+	}
+	cont, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(cont), "service2") || !strings.Contains(string(cont), "service3") {
+		t.Fatalf("unexpected list cache content %q", cont)
+	}
+}
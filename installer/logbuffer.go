@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package installer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// bufferedHandler is a slog.Handler that holds records until flushed.
+// It keeps logs of services installed concurrently from interleaving.
+// It also holds output written through its output function,
+// in order with the records.
+type bufferedHandler struct {
+	handler slog.Handler
+	buf     *logBuffer
+}
+
+type logBuffer struct {
+	records []bufferedRecord
+	mu      sync.Mutex
+}
+
+// bufferedRecord is either a log record or output for dst.
+type bufferedRecord struct {
+	handler slog.Handler
+	record  slog.Record
+
+	dst io.Writer
+	out []byte
+}
+
+func newBufferedHandler(handler slog.Handler) bufferedHandler {
+	return bufferedHandler{
+		handler: handler,
+		buf:     &logBuffer{},
+	}
+}
+
+// Enabled implements slog.Handler's Enabled function.
+func (h bufferedHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler's Handle function.
+func (h bufferedHandler) Handle(_ context.Context, rec slog.Record) error {
+	h.buf.mu.Lock()
+	defer h.buf.mu.Unlock()
+	h.buf.records = append(h.buf.records, bufferedRecord{handler: h.handler, record: rec.Clone()})
+	return nil
+}
+
+// WithAttrs implements slog.Handler's WithAttrs function.
+func (h bufferedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return bufferedHandler{handler: h.handler.WithAttrs(attrs), buf: h.buf}
+}
+
+// WithGroup implements slog.Handler's WithGroup function.
+func (h bufferedHandler) WithGroup(group string) slog.Handler {
+	return bufferedHandler{handler: h.handler.WithGroup(group), buf: h.buf}
+}
+
+// output returns an io.Writer that holds what is written to it
+// until flushed, then writes it to dst.
+func (h bufferedHandler) output(dst io.Writer) io.Writer {
+	return bufferedOutput{dst: dst, buf: h.buf}
+}
+
+// flush passes all the records held so far to the underlying handler,
+// and writes the held output.
+func (h bufferedHandler) flush() error {
+	h.buf.mu.Lock()
+	defer h.buf.mu.Unlock()
+	for _, rec := range h.buf.records {
+		var err error
+		if rec.dst != nil {
+			_, err = rec.dst.Write(rec.out)
+		} else {
+			err = rec.handler.Handle(context.Background(), rec.record)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	h.buf.records = nil
+	return nil
+}
+
+type bufferedOutput struct {
+	dst io.Writer
+	buf *logBuffer
+}
+
+// Write implements io.Writer's Write function.
+func (o bufferedOutput) Write(p []byte) (int, error) {
+	o.buf.mu.Lock()
+	defer o.buf.mu.Unlock()
+	o.buf.records = append(o.buf.records, bufferedRecord{dst: o.dst, out: bytes.Clone(p)})
+	return len(p), nil
+}
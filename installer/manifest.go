@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package installer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileKind is the way a file was written.
+type FileKind string
+
+const (
+	FileKindLink FileKind = "link"
+	FileKindCopy FileKind = "copy"
+)
+
+// FileRecord describes a file written while installing a service.
+type FileRecord struct {
+	Kind FileKind `json:"kind"`
+	// Path is the destination path.
+	Path string `json:"path"`
+	// Source is the path of the file that was linked or copied.
+	Source string `json:"source"`
+	Mode   uint16 `json:"mode,omitempty"`
+	// Hash is the SHA-256 checksum of the written content,
+	// or of the link target when Kind is FileKindLink. It is empty for directories.
+	Hash string `json:"hash,omitempty"`
+	// Backup is the path where the previous file at Path was moved to, if any.
+	Backup string    `json:"backup,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// ServiceRecord describes an installed service.
+type ServiceRecord struct {
+	InstalledAt time.Time    `json:"installed_at"`
+	Files       []FileRecord `json:"files"`
+}
+
+// Manifest records every file written for each installed service.
+// A service is in the manifest only if all of its steps succeeded.
+// Its methods are safe for concurrent use.
+type Manifest struct {
+	Services map[string]ServiceRecord `json:"services"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// NewManifest returns an empty Manifest that is never saved to disk.
+func NewManifest() *Manifest {
+	return &Manifest{Services: make(map[string]ServiceRecord)}
+}
+
+// NewManifestFrom returns a Manifest decoded from r.
+// Saving it has no effect.
+func NewManifestFrom(r io.Reader) (*Manifest, error) {
+	man := NewManifest()
+	err := json.NewDecoder(r).Decode(man)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if man.Services == nil {
+		man.Services = make(map[string]ServiceRecord)
+	}
+	return man, nil
+}
+
+// LoadManifest returns the Manifest stored at path, which
+// will be updated on Save. If path does not exist, the Manifest is empty.
+func LoadManifest(path string) (*Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		man := NewManifest()
+		man.path = path
+		return man, nil
+	}
+	defer file.Close()
+	man, err := NewManifestFrom(file)
+	if err != nil {
+		return nil, err
+	}
+	man.path = path
+	return man, nil
+}
+
+// Contains returns whether name was fully installed.
+func (m *Manifest) Contains(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.Services[name]
+	return ok
+}
+
+// Record returns the record of the service named name.
+func (m *Manifest) Record(name string) (ServiceRecord, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, ok := m.Services[name]
+	return rec, ok
+}
+
+// Set sets the record of the service named name.
+func (m *Manifest) Set(name string, rec ServiceRecord) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Services[name] = rec
+}
+
+// Remove removes the record of the service named name.
+func (m *Manifest) Remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.Services, name)
+}
+
+// Save writes the manifest to disk, if it was loaded from a path.
+// The previous content is replaced atomically.
+func (m *Manifest) Save() error {
+	if m.path == "" {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := os.MkdirAll(filepath.Dir(m.path), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	enc := json.NewEncoder(tmp)
+	enc.SetIndent("", "\t")
+	err = enc.Encode(m)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.path)
+}
+
+// hashFile returns the SHA-256 checksum of the file at path.
+// If path is a directory, the checksum is empty.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", nil
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashCopy returns the SHA-256 checksum of the content fc writes.
+func hashCopy(fc FileCopy) (string, error) {
+	h := sha256.New()
+	_, err := fc.WriteTo(h)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package installer_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/livingsilver94/backee/installer"
+)
+
+func TestLoadManifestNotExist(t *testing.T) {
+	man, err := installer.LoadManifest(filepath.Join(t.TempDir(), "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(man.Services) != 0 {
+		t.Fatalf("expected empty manifest. Got %v", man.Services)
+	}
+}
+
+func TestManifestSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "manifest.json")
+	man, err := installer.LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := installer.ServiceRecord{
+		InstalledAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Files: []installer.FileRecord{
+			{Kind: installer.FileKindCopy, Path: "/dst", Source: "/src", Mode: 0o600, Hash: "abc"},
+		},
+	}
+	man.Set(serviceName, expected)
+	err = man.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := installer.LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obtained, ok := loaded.Record(serviceName)
+	if !ok {
+		t.Fatalf("manifest doesn't contain %q", serviceName)
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Fatalf("expected record %#v. Got %#v", expected, obtained)
+	}
+}
+
+func TestNewManifestFromEmpty(t *testing.T) {
+	man, err := installer.NewManifestFrom(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.Contains(serviceName) {
+		t.Fatalf("empty manifest contains %q", serviceName)
+	}
+	man.Set(serviceName, installer.ServiceRecord{})
+	if !man.Contains(serviceName) {
+		t.Fatalf("manifest doesn't contain %q", serviceName)
+	}
+}
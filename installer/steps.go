@@ -5,13 +5,20 @@ package installer
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 	"unsafe"
 
+	"github.com/livingsilver94/backee/pkgmanager"
 	"github.com/livingsilver94/backee/repo"
 	"github.com/livingsilver94/backee/service"
 )
@@ -22,36 +29,220 @@ type StepWriter interface {
 	SymlinkFile(dst service.FilePath, src string) error
 	CopyFile(dst service.FilePath, src FileCopy) error
 	Finalize(script string) error
+
+	Uninstall(script string) error
+	RemoveSymlink(dst service.FilePath, src string) error
+	RemoveFile(dst service.FilePath) error
+}
+
+// SkipWriter is implemented by StepWriters that report
+// the entries skipped because their condition does not hold.
+type SkipWriter interface {
+	Skip(entry, when string) error
+}
+
+// OutputWriter is implemented by StepWriters that print output,
+// such as previews or the standard error of scripts.
+type OutputWriter interface {
+	// WithOutput returns a copy of the StepWriter
+	// that prints to wrap(w) instead of w.
+	WithOutput(wrap func(w io.Writer) io.Writer) StepWriter
+}
+
+// Decrypter decrypts copied files encrypted with age.
+type Decrypter interface {
+	// Decrypt decrypts the age file read from r.
+	Decrypt(r io.Reader) ([]byte, error)
 }
 
+// ErrNoDecrypter is returned when copying an encrypted file without a Decrypter.
+var ErrNoDecrypter = errors.New("no identity to decrypt files")
+
+// Condition evaluates the condition of an entry.
+type Condition func(when string) (bool, error)
+
+// ErrForeignFile is returned by a StepWriter when it refuses
+// to remove a file that was not written by Backee.
+var ErrForeignFile = errors.New("file is not managed by backee")
+
+// ErrNotWritten is returned by a StepWriter when it leaves an existing
+// destination as it is, because it's up to date or its conflict policy
+// is skip. Such a file is not owned by Backee.
+var ErrNotWritten = errors.New("not written")
+
 type Steps struct {
 	srv *service.Service
 	log *slog.Logger
 	wri StepWriter
+	rec *ServiceRecord
+	pm  pkgmanager.PackageManager
+	// noPackages skips the installation of packages.
+	noPackages bool
+	// cond evaluates the when key of entries.
+	cond Condition
+	// dec decrypts copied files with service.AgeExt extension.
+	dec Decrypter
+
+	conflict service.ConflictPolicy
+	// backupSuffix is appended to destination paths to make backup paths.
+	backupSuffix string
 }
 
+// BackupInfix precedes the timestamp of backup files.
+const BackupInfix = ".backee-bak."
+
 func NewSteps(srv *service.Service, wri StepWriter) Steps {
 	return Steps{
-		srv: srv,
-		log: slog.Default().WithGroup(srv.Name),
-		wri: wri,
+		srv:          srv,
+		log:          slog.Default().WithGroup(srv.Name),
+		wri:          wri,
+		backupSuffix: BackupInfix + time.Now().UTC().Format("20060102T150405"),
+	}
+}
+
+// WithLogger returns a copy of s that logs to log.
+func (s Steps) WithLogger(log *slog.Logger) Steps {
+	s.log = log
+	return s
+}
+
+// WithPackageManager returns a copy of s that installs packages with pm,
+// unless the service defines its own package manager command.
+func (s Steps) WithPackageManager(pm pkgmanager.PackageManager) Steps {
+	s.pm = pm
+	return s
+}
+
+// WithoutPackages returns a copy of s that doesn't install packages,
+// nor looks for a package manager to do so.
+func (s Steps) WithoutPackages() Steps {
+	s.noPackages = true
+	return s
+}
+
+// WithCondition returns a copy of s that evaluates
+// the conditions of entries with cond.
+func (s Steps) WithCondition(cond Condition) Steps {
+	s.cond = cond
+	return s
+}
+
+// WithDecrypter returns a copy of s that decrypts
+// copied files with service.AgeExt extension with dec.
+func (s Steps) WithDecrypter(dec Decrypter) Steps {
+	s.dec = dec
+	return s
+}
+
+// WithConflictPolicy returns a copy of s that applies policy to links and copies
+// that do not specify their own.
+func (s Steps) WithConflictPolicy(policy service.ConflictPolicy) Steps {
+	s.conflict = policy
+	return s
+}
+
+// WithRecord returns a copy of s that appends
+// every file it links or copies to rec.
+func (s Steps) WithRecord(rec *ServiceRecord) Steps {
+	s.rec = rec
+	return s
+}
+
+// withOutput returns a copy of s whose StepWriter, if it's an OutputWriter,
+// prints through wrap.
+func (s Steps) withOutput(wrap func(w io.Writer) io.Writer) Steps {
+	if ow, ok := s.wri.(OutputWriter); ok {
+		s.wri = ow.WithOutput(wrap)
 	}
+	return s
 }
 
 func (s Steps) Setup() error {
-	if s.srv.Setup == nil || *s.srv.Setup == "" {
+	if s.srv.Setup == nil || s.srv.Setup.Run == "" {
 		return nil
 	}
+	ok, err := s.enabled("setup script", s.srv.Setup.When)
+	if !ok || err != nil {
+		return err
+	}
 	s.log.Info("Running setup script")
-	return s.wri.Setup(*s.srv.Setup)
+	return s.wri.Setup(s.srv.Setup.Run)
 }
 
 func (s Steps) InstallPackages() error {
-	if len(s.srv.Packages) == 0 {
+	if len(s.srv.Packages) == 0 || s.noPackages {
+		return nil
+	}
+	pkgs, err := s.packages()
+	if err != nil || len(pkgs) == 0 {
+		return err
+	}
+	cmd, err := packageCommand(s.pm, s.srv.PkgManager, pkgs)
+	if err != nil {
+		return err
+	}
+	if cmd == nil {
+		s.log.Info("OS packages already installed")
 		return nil
 	}
 	s.log.Info("Installing OS packages")
-	return s.wri.InstallPackages(append(s.srv.PkgManager, s.srv.Packages...))
+	return s.wri.InstallPackages(cmd)
+}
+
+// ErrNoPkgManager is returned when packages must be installed,
+// but there is no package manager to do so.
+var ErrNoPkgManager = errors.New("no package manager available: set pkgmanager in the service")
+
+// packages returns the packages of the service whose condition holds.
+func (s Steps) packages() ([]service.Package, error) {
+	pkgs := make([]service.Package, 0, len(s.srv.Packages))
+	for _, pkg := range s.srv.Packages {
+		ok, err := s.enabled("package "+pkg.Name, pkg.When)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs, nil
+}
+
+// packageCommand returns the command that installs pkgs with the package
+// manager command pkgManager. When pkgManager is empty, the command is built by pm
+// and omits installed packages. The command is nil if there is nothing to install.
+func packageCommand(pm pkgmanager.PackageManager, pkgManager []string, pkgs []service.Package) ([]string, error) {
+	if len(pkgManager) != 0 {
+		return append(slices.Clone(pkgManager), packageNames(pkgs, "")...), nil
+	}
+	if pm == nil {
+		return nil, ErrNoPkgManager
+	}
+	names := packageNames(pkgs, pm.Name())
+	installed, err := pm.Installed(names)
+	if err != nil {
+		return nil, err
+	}
+	missing := slices.DeleteFunc(names, func(name string) bool {
+		return slices.Contains(installed, name)
+	})
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	return pm.InstallCommand(missing), nil
+}
+
+// packageNames returns the deduplicated names of pkgs,
+// as known by the driver named driver.
+func packageNames(pkgs []service.Package, driver string) []string {
+	var names []string
+	for _, pkg := range pkgs {
+		name := pkg.NameFor(driver)
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
 func (s Steps) LinkFiles(repo repo.Repo, vars repo.Variables) error {
@@ -71,9 +262,26 @@ func (s Steps) LinkFiles(repo repo.Repo, vars repo.Variables) error {
 		if err != nil {
 			return err
 		}
-		err = s.wri.SymlinkFile(
-			service.FilePath{Path: dest.String(), Mode: dstFile.Mode},
-			filepath.Join(lnDir, srcFile))
+		ok, err := s.enabled("link "+dest.String(), dstFile.When)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			dest.Reset()
+			continue
+		}
+		dst := s.destination(dest.String(), dstFile)
+		src := filepath.Join(lnDir, srcFile)
+		err = s.wri.SymlinkFile(dst, src)
+		if err != nil {
+			if !errors.Is(err, ErrNotWritten) {
+				return err
+			}
+			s.log.Info(dst.Path + ": " + err.Error())
+			dest.Reset()
+			continue
+		}
+		err = s.recordFile(FileKindLink, dst, src, func() (string, error) { return hashFile(src) })
 		if err != nil {
 			return err
 		}
@@ -99,9 +307,35 @@ func (s Steps) CopyFiles(repo repo.Repo, vars repo.Variables) error {
 		if err != nil {
 			return err
 		}
-		err = s.wri.CopyFile(
-			service.FilePath{Path: dest.String(), Mode: dstFile.Mode},
-			FileCopy{Src: filepath.Join(dataDir, srcFile), Templ: tmpl})
+		ok, err := s.enabled("copy "+dest.String(), dstFile.When)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			dest.Reset()
+			continue
+		}
+		dst := s.destination(dest.String(), dstFile)
+		src := FileCopy{
+			Src:       filepath.Join(dataDir, srcFile),
+			Templ:     tmpl,
+			Engine:    dstFile.EngineFor(srcFile),
+			DataDir:   dataDir,
+			Decrypter: s.dec,
+		}
+		if src.Encrypted() && dst.Mode == 0 {
+			dst.Mode = 0o600
+		}
+		err = s.wri.CopyFile(dst, src)
+		if err != nil {
+			if !errors.Is(err, ErrNotWritten) {
+				return err
+			}
+			s.log.Info(dst.Path + ": " + err.Error())
+			dest.Reset()
+			continue
+		}
+		err = s.recordFile(FileKindCopy, dst, src.Src, func() (string, error) { return hashCopy(src) })
 		if err != nil {
 			return err
 		}
@@ -111,42 +345,310 @@ func (s Steps) CopyFiles(repo repo.Repo, vars repo.Variables) error {
 }
 
 func (s Steps) Finalize(vars repo.Variables) error {
-	if s.srv.Finalize == nil || *s.srv.Finalize == "" {
+	if s.srv.Finalize == nil || s.srv.Finalize.Run == "" {
 		return nil
 	}
+	ok, err := s.enabled("finalizer script", s.srv.Finalize.When)
+	if !ok || err != nil {
+		return err
+	}
 	s.log.Info("Running finalizer script")
 	tmpl := NewTemplate(s.srv.Name, vars)
 	script := &strings.Builder{}
-	_, err := tmpl.ReplaceString(*s.srv.Finalize, script)
+	_, err = tmpl.ReplaceString(s.srv.Finalize.Run, script)
 	if err != nil {
 		return err
 	}
 	return s.wri.Finalize(script.String())
 }
 
+func (s Steps) Uninstall(vars repo.Variables) error {
+	if s.srv.Uninstall == nil || s.srv.Uninstall.Run == "" {
+		return nil
+	}
+	ok, err := s.enabled("uninstall script", s.srv.Uninstall.When)
+	if !ok || err != nil {
+		return err
+	}
+	s.log.Info("Running uninstall script")
+	tmpl := NewTemplate(s.srv.Name, vars)
+	script := &strings.Builder{}
+	_, err = tmpl.ReplaceString(s.srv.Uninstall.Run, script)
+	if err != nil {
+		return err
+	}
+	return s.wri.Uninstall(script.String())
+}
+
+func (s Steps) UnlinkFiles(repo repo.Repo, vars repo.Variables) error {
+	if len(s.srv.Links) == 0 {
+		return nil
+	}
+	s.log.Info("Removing symlinks")
+
+	lnDir, err := repo.LinkDir(s.srv.Name)
+	if err != nil {
+		return err
+	}
+	tmpl := NewTemplate(s.srv.Name, vars)
+	dest := &strings.Builder{}
+	for srcFile, dstFile := range s.srv.Links {
+		_, err := tmpl.ReplaceString(dstFile.Path, dest)
+		if err != nil {
+			return err
+		}
+		ok, err := s.enabled("link "+dest.String(), dstFile.When)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			dest.Reset()
+			continue
+		}
+		err = s.wri.RemoveSymlink(
+			service.FilePath{Path: dest.String(), Mode: dstFile.Mode},
+			filepath.Join(lnDir, srcFile))
+		if err != nil {
+			if !errors.Is(err, ErrForeignFile) {
+				return err
+			}
+			s.log.Warn("Not removing " + dest.String() + ": " + err.Error())
+		}
+		dest.Reset()
+	}
+	return nil
+}
+
+// RemoveCopies removes the copies of the service.
+// Copies whose content differs from what CopyFiles would write are left untouched,
+// as are copies whose source can't be rendered anymore.
+func (s Steps) RemoveCopies(repo repo.Repo, vars repo.Variables) error {
+	if len(s.srv.Copies) == 0 {
+		return nil
+	}
+	s.log.Info("Removing copied files")
+
+	dataDir, err := repo.DataDir(s.srv.Name)
+	if err != nil {
+		return err
+	}
+	tmpl := NewTemplate(s.srv.Name, vars)
+	dest := &strings.Builder{}
+	for srcFile, dstFile := range s.srv.Copies {
+		_, err := tmpl.ReplaceString(dstFile.Path, dest)
+		if err != nil {
+			return err
+		}
+		ok, err := s.enabled("copy "+dest.String(), dstFile.When)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			dest.Reset()
+			continue
+		}
+		src := FileCopy{
+			Src:       filepath.Join(dataDir, srcFile),
+			Templ:     tmpl,
+			Engine:    dstFile.EngineFor(srcFile),
+			DataDir:   dataDir,
+			Decrypter: s.dec,
+		}
+		hash, err := hashCopy(src)
+		if err != nil {
+			// The source may have been moved or deleted since installation.
+			s.log.Warn("Not removing " + dest.String() + ": can't verify its content: " + err.Error())
+			dest.Reset()
+			continue
+		}
+		err = s.removeCopy(service.FilePath{Path: dest.String(), Mode: dstFile.Mode}, hash)
+		if err != nil {
+			if !errors.Is(err, ErrForeignFile) {
+				return err
+			}
+			s.log.Warn("Not removing " + dest.String() + ": " + err.Error())
+		}
+		dest.Reset()
+	}
+	return nil
+}
+
+// RemoveRecorded removes the files listed in rec, in reverse order.
+// Copies whose content changed since rec was written are left untouched.
+func (s Steps) RemoveRecorded(rec ServiceRecord) error {
+	if len(rec.Files) == 0 {
+		return nil
+	}
+	s.log.Info("Removing installed files")
+	for i := len(rec.Files) - 1; i >= 0; i-- {
+		file := rec.Files[i]
+		dst := service.FilePath{Path: file.Path, Mode: file.Mode, Backup: file.Backup}
+		var err error
+		switch file.Kind {
+		case FileKindLink:
+			err = s.wri.RemoveSymlink(dst, file.Source)
+		case FileKindCopy:
+			err = s.removeCopy(dst, file.Hash)
+		}
+		if err != nil {
+			if !errors.Is(err, ErrForeignFile) {
+				return err
+			}
+			s.log.Warn("Not removing " + file.Path + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// removeCopy removes dst if its checksum is hash.
+func (s Steps) removeCopy(dst service.FilePath, hash string) error {
+	live, err := hashFile(dst.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if !errors.Is(err, fs.ErrPermission) {
+			return err
+		}
+		// We can't verify the content. Trust the caller.
+		live = hash
+	}
+	if live != hash {
+		return fmt.Errorf("content changed since installation: %w", ErrForeignFile)
+	}
+	return s.wri.RemoveFile(dst)
+}
+
+// enabled returns whether the condition when of entry holds.
+// An empty condition always holds. Entries that are skipped
+// are logged and reported to the StepWriter.
+func (s Steps) enabled(entry, when string) (bool, error) {
+	if when == "" {
+		return true, nil
+	}
+	if s.cond == nil {
+		return false, fmt.Errorf("%s: conditions are not supported", entry)
+	}
+	ok, err := s.cond(when)
+	if err != nil {
+		return false, fmt.Errorf("%s: condition %q: %w", entry, when, err)
+	}
+	if ok {
+		return true, nil
+	}
+	s.log.Info("Skipping " + entry + ": condition " + strconv.Quote(when) + " does not hold")
+	if sw, ok := s.wri.(SkipWriter); ok {
+		return false, sw.Skip(entry, when)
+	}
+	return false, nil
+}
+
+// destination returns the FilePath to pass to the StepWriter
+// for a link or copy entry, whose path was already resolved.
+func (s Steps) destination(path string, entry service.FilePath) service.FilePath {
+	dst := service.FilePath{Path: path, Mode: entry.Mode, Conflict: entry.Conflict}
+	if dst.Conflict == "" {
+		dst.Conflict = s.conflict
+	}
+	if dst.Conflict == service.ConflictBackup {
+		dst.Backup = path + s.backupSuffix
+	}
+	return dst
+}
+
+// recordFile appends a file to the record, if any.
+// hash is only called when there is a record to fill.
+// If dst was backed up, the backup is logged and recorded as well.
+func (s Steps) recordFile(kind FileKind, dst service.FilePath, src string, hash func() (string, error)) error {
+	backup := ""
+	if dst.Backup != "" {
+		if _, err := os.Lstat(dst.Backup); err == nil {
+			backup = dst.Backup
+			s.log.Info("Backed up " + dst.Path + " to " + backup)
+		}
+	}
+	if s.rec == nil {
+		return nil
+	}
+	sum, err := hash()
+	if err != nil {
+		return err
+	}
+	s.rec.Files = append(s.rec.Files, FileRecord{
+		Kind:   kind,
+		Path:   dst.Path,
+		Source: src,
+		Mode:   dst.Mode,
+		Hash:   sum,
+		Backup: backup,
+		Time:   time.Now().UTC(),
+	})
+	return nil
+}
+
 type FileCopy struct {
 	Src   string
 	Templ Template
+	// Engine renders Src. When empty, it is service.EnginePlain.
+	Engine service.TemplateEngine
+	// DataDir is where Go templates include files from.
+	DataDir string
+	// Decrypter decrypts Src, if it's Encrypted.
+	Decrypter Decrypter
+}
+
+// Encrypted returns whether Src is encrypted with age,
+// as told by its service.AgeExt extension.
+func (fc FileCopy) Encrypted() bool {
+	return strings.HasSuffix(fc.Src, service.AgeExt)
 }
 
+// WriteTo writes the content of Src, decrypted if needed, and then rendered.
+// The plain text of encrypted files is only held in memory.
 func (fc FileCopy) WriteTo(w io.Writer) (n int64, err error) {
 	file, err := os.Open(fc.Src)
 	if err != nil {
 		return 0, err
 	}
 	defer file.Close()
-	cont, err := io.ReadAll(file) // TODO: reuse buffer.
-	if err != nil {
-		return 0, err
+	var cont []byte
+	if fc.Encrypted() {
+		if fc.Decrypter == nil {
+			return 0, fmt.Errorf("%s: %w", fc.Src, ErrNoDecrypter)
+		}
+		cont, err = fc.Decrypter.Decrypt(file)
+		if err != nil {
+			return 0, fmt.Errorf("decrypting %s: %w", fc.Src, err)
+		}
+	} else {
+		cont, err = io.ReadAll(file) // TODO: reuse buffer.
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(cont) == 0 {
+		return 0, nil
 	}
 	if isBinary(cont) {
 		n, err := w.Write(cont)
 		return int64(n), err
 	}
-	return fc.Templ.ReplaceString(unsafe.String(&cont[0], len(cont)), w)
+	text := unsafe.String(&cont[0], len(cont))
+	if fc.Engine == service.EngineGo {
+		name, err := filepath.Rel(fc.DataDir, strings.TrimSuffix(fc.Src, service.AgeExt))
+		if err != nil {
+			name = filepath.Base(fc.Src)
+		}
+		return fc.Templ.ExecuteGo(name, text, fc.DataDir, w)
+	}
+	return fc.Templ.ReplaceString(text, w)
 }
 
+// String returns the content of the file, unless it's binary or encrypted.
 func (fc FileCopy) String() string {
+	if fc.Encrypted() {
+		return "*encrypted*"
+	}
 	buf := &bytes.Buffer{}
 	_, err := fc.WriteTo(buf)
 	if err != nil {
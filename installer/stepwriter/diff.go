@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package stepwriter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/livingsilver94/backee/installer"
+	"github.com/livingsilver94/backee/redact"
+	"github.com/livingsilver94/backee/service"
+)
+
+// Diff compares the files that would be linked or copied
+// with the live filesystem, and reports any drift. It never writes any file
+// and it does not run scripts nor install packages.
+type Diff struct {
+	// Dest is where drifts are reported.
+	// When nil, it defaults to [os.Stdout].
+	Dest io.Writer
+	// Patch enables printing a unified diff for text files whose content differs.
+	Patch bool
+
+	// Drifts is the number of drifts found so far.
+	Drifts int
+}
+
+func (d *Diff) Setup(script string) error {
+	return nil
+}
+
+func (d *Diff) InstallPackages(fullCmd []string) error {
+	return nil
+}
+
+func (d *Diff) SymlinkFile(dst service.FilePath, src string) error {
+	info, err := os.Lstat(dst.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return d.report(dst.Path, "missing")
+		}
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return d.report(dst.Path, "not a symlink")
+	}
+	wr := symlinkWriter{SrcPath: src}
+	eq, err := wr.isSymlinkEqual(dst.Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if !eq {
+		target, err := os.Readlink(dst.Path)
+		if err != nil {
+			return err
+		}
+		return d.report(dst.Path, fmt.Sprintf("points to %s instead of %s", target, src))
+	}
+	return d.compareMode(dst)
+}
+
+func (d *Diff) CopyFile(dst service.FilePath, src installer.FileCopy) error {
+	live, err := os.ReadFile(dst.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return d.report(dst.Path, "missing")
+		}
+		if errors.Is(err, fs.ErrPermission) {
+			// Its content can't be compared, but other files can.
+			return d.report(dst.Path, "unreadable")
+		}
+		return err
+	}
+	expected := &bytes.Buffer{}
+	_, err = src.WriteTo(expected)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(live, expected.Bytes()) {
+		if bytes.ContainsRune(live, 0x0) || bytes.ContainsRune(expected.Bytes(), 0x0) {
+			return d.report(dst.Path, "binary content differs")
+		}
+		if src.Encrypted() {
+			// Never print the plain text of secrets.
+			return d.report(dst.Path, "encrypted content differs")
+		}
+		err := d.report(dst.Path, "content differs")
+		if err != nil {
+			return err
+		}
+		if d.Patch {
+			err = writeUnifiedDiff(d.dest(), dst.Path+" (live)", dst.Path+" (expected)",
+				redact.Default.String(string(live)), redact.Default.String(expected.String()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return d.compareMode(dst)
+}
+
+func (d *Diff) Finalize(script string) error {
+	return nil
+}
+
+func (d *Diff) Uninstall(script string) error {
+	return nil
+}
+
+func (d *Diff) RemoveSymlink(dst service.FilePath, src string) error {
+	return nil
+}
+
+func (d *Diff) RemoveFile(dst service.FilePath) error {
+	return nil
+}
+
+// compareMode reports dst if its permissions differ from the expected ones.
+// Permissions of symlinks are those of their target.
+func (d *Diff) compareMode(dst service.FilePath) error {
+	if dst.Mode == 0 {
+		return nil
+	}
+	info, err := os.Stat(dst.Path)
+	if err != nil {
+		return err
+	}
+	if perm := info.Mode().Perm(); perm != fs.FileMode(dst.Mode) {
+		return d.report(dst.Path, fmt.Sprintf("mode %o instead of %o", perm, dst.Mode))
+	}
+	return nil
+}
+
+func (d *Diff) report(path, reason string) error {
+	d.Drifts++
+	_, err := fmt.Fprintf(d.dest(), "%s: %s\n", path, reason)
+	return err
+}
+
+func (d *Diff) dest() io.Writer {
+	if d.Dest == nil {
+		return os.Stdout
+	}
+	return d.Dest
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package stepwriter_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livingsilver94/backee/installer"
+	"github.com/livingsilver94/backee/installer/stepwriter"
+	"github.com/livingsilver94/backee/repo"
+	"github.com/livingsilver94/backee/service"
+)
+
+func TestDiffCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	os.WriteFile(src, []byte("line1\nline2\n"), 0644)
+	os.WriteFile(dst, []byte("line1\nedited\n"), 0644)
+
+	out := &strings.Builder{}
+	diff := stepwriter.Diff{Dest: out, Patch: true}
+	fc := installer.FileCopy{Src: src, Templ: installer.NewTemplate("srv", repo.NewVariables())}
+	err := diff.CopyFile(service.FilePath{Path: dst}, fc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Drifts != 1 {
+		t.Fatalf("expected 1 drift. Got %d", diff.Drifts)
+	}
+	if !strings.Contains(out.String(), "-edited\n+line2\n") {
+		t.Fatalf("unexpected diff output %q", out.String())
+	}
+}
+
+func TestDiffCopyEqual(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	os.WriteFile(src, []byte("content"), 0600)
+
+	diff := stepwriter.Diff{Dest: &strings.Builder{}}
+	fc := installer.FileCopy{Src: src, Templ: installer.NewTemplate("srv", repo.NewVariables())}
+	err := diff.CopyFile(service.FilePath{Path: src, Mode: 0o600}, fc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Drifts != 0 {
+		t.Fatalf("expected no drifts. Got %d", diff.Drifts)
+	}
+}
+
+func TestDiffCopyUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	os.WriteFile(src, []byte("content"), 0644)
+	os.WriteFile(dst, []byte("content"), 0)
+	if _, err := os.ReadFile(dst); err == nil {
+		t.Skip("file permissions are not enforced")
+	}
+
+	out := &strings.Builder{}
+	diff := stepwriter.Diff{Dest: out}
+	fc := installer.FileCopy{Src: src, Templ: installer.NewTemplate("srv", repo.NewVariables())}
+	err := diff.CopyFile(service.FilePath{Path: dst}, fc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Drifts != 1 || !strings.Contains(out.String(), "unreadable") {
+		t.Fatalf("expected an unreadable drift. Got %d, %q", diff.Drifts, out.String())
+	}
+}
+
+func TestDiffSymlink(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	other := filepath.Join(dir, "other")
+	os.WriteFile(src, nil, 0644)
+	os.WriteFile(other, nil, 0644)
+	err := os.Symlink(other, filepath.Join(dir, "elsewhere"))
+	if err != nil {
+		t.Skip("cannot create symlinks: ", err)
+	}
+	os.Symlink(src, filepath.Join(dir, "good"))
+
+	tests := []struct {
+		dst    string
+		drifts int
+	}{
+		{dst: "good", drifts: 0},
+		{dst: "elsewhere", drifts: 1},
+		{dst: "missing", drifts: 1},
+		{dst: "other", drifts: 1},
+	}
+	for _, test := range tests {
+		diff := stepwriter.Diff{Dest: &strings.Builder{}}
+		err := diff.SymlinkFile(service.FilePath{Path: filepath.Join(dir, test.dst)}, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff.Drifts != test.drifts {
+			t.Fatalf("%s: expected %d drifts. Got %d", test.dst, test.drifts, diff.Drifts)
+		}
+	}
+}
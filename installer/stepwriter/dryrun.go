@@ -8,9 +8,11 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/livingsilver94/backee/installer"
+	"github.com/livingsilver94/backee/redact"
 	"github.com/livingsilver94/backee/service"
 )
 
@@ -30,7 +32,7 @@ func (d DryRun) Setup(script string) error {
 }
 
 func (d DryRun) InstallPackages(fullCmd []string) error {
-	_, err := d.printf("Will run %q", strings.Join(fullCmd, " "))
+	_, err := d.printf("Will run %q\n", strings.Join(fullCmd, " "))
 	return err
 }
 
@@ -50,6 +52,10 @@ func (d DryRun) SymlinkFile(dst service.FilePath, src string) error {
 			return err
 		}
 	}
+	err = d.printConflict(dst)
+	if err != nil {
+		return err
+	}
 	_, err = d.println()
 	return err
 }
@@ -65,6 +71,10 @@ func (d DryRun) CopyFile(dst service.FilePath, src installer.FileCopy) error {
 			return err
 		}
 	}
+	err = d.printConflict(dst)
+	if err != nil {
+		return err
+	}
 	_, err = d.println(" with the following content:")
 	if err != nil {
 		return err
@@ -74,18 +84,80 @@ func (d DryRun) CopyFile(dst service.FilePath, src installer.FileCopy) error {
 }
 
 func (d DryRun) Finalize(script string) error {
-	_, err := fmt.Print(script)
+	_, err := d.print(script)
+	return err
+}
+
+func (d DryRun) Uninstall(script string) error {
+	_, err := d.print(script)
+	return err
+}
+
+func (d DryRun) RemoveSymlink(dst service.FilePath, src string) error {
+	_, err := d.printf("Will remove symlink %q if it points to %q", dst.Path, src)
+	if err != nil {
+		return err
+	}
+	return d.printRestore(dst)
+}
+
+func (d DryRun) RemoveFile(dst service.FilePath) error {
+	_, err := d.printf("Will remove %q", dst.Path)
+	if err != nil {
+		return err
+	}
+	return d.printRestore(dst)
+}
+
+// Skip implements installer.SkipWriter.
+func (d DryRun) Skip(entry, when string) error {
+	_, err := d.printf("Will skip %s because %q does not hold\n", entry, when)
+	return err
+}
+
+// printConflict prints what happens if dst already exists.
+func (d DryRun) printConflict(dst service.FilePath) error {
+	var err error
+	switch dst.Conflict {
+	case service.ConflictSkip:
+		_, err = d.print(", unless it exists")
+	case service.ConflictOverwrite:
+		_, err = d.print(", overwriting any existing file")
+	case service.ConflictBackup:
+		_, err = d.printf(", backing up any existing file to %q", dst.Backup)
+	}
+	return err
+}
+
+func (d DryRun) printRestore(dst service.FilePath) error {
+	var err error
+	if dst.Backup != "" {
+		_, err = d.printf(" and restore %q", dst.Backup)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = d.println()
 	return err
 }
 
 func (d DryRun) fileAccessible(path string) (bool, error) {
-	f := d.FS
-	if f == nil {
-		f = os.DirFS(".")
+	var (
+		file fs.File
+		err  error
+	)
+	if filepath.IsAbs(path) {
+		// fs.FS does not accept absolute paths.
+		file, err = os.Open(path)
+	} else {
+		f := d.FS
+		if f == nil {
+			f = os.DirFS(".")
+		}
+		file, err = f.Open(path)
 	}
-	file, err := f.Open(path)
 	if err != nil {
-		_, err = d.printf("Error opening %s: %s", path, err)
+		_, err = d.printf("Error opening %s: %s\n", path, err)
 		return false, err
 	}
 	defer file.Close()
@@ -93,25 +165,31 @@ func (d DryRun) fileAccessible(path string) (bool, error) {
 }
 
 func (d DryRun) print(a ...any) (n int, err error) {
-	dest := d.Dest
-	if dest == nil {
-		dest = os.Stdout
-	}
-	return fmt.Fprint(d.Dest, a...)
+	return d.write(fmt.Sprint(a...))
 }
 
 func (d DryRun) printf(format string, a ...any) (n int, err error) {
-	dest := d.Dest
-	if dest == nil {
-		dest = os.Stdout
-	}
-	return fmt.Fprintf(d.Dest, format, a...)
+	return d.write(fmt.Sprintf(format, a...))
 }
 
 func (d DryRun) println(a ...any) (n int, err error) {
-	dest := d.Dest
-	if dest == nil {
-		dest = os.Stdout
+	return d.write(fmt.Sprintln(a...))
+}
+
+// WithOutput implements installer.OutputWriter.
+func (d DryRun) WithOutput(wrap func(w io.Writer) io.Writer) installer.StepWriter {
+	d.Dest = wrap(d.dest())
+	return d
+}
+
+// write writes s to Dest, with secrets masked.
+func (d DryRun) write(s string) (n int, err error) {
+	return io.WriteString(d.dest(), redact.Default.String(s))
+}
+
+func (d DryRun) dest() io.Writer {
+	if d.Dest == nil {
+		return os.Stdout
 	}
-	return fmt.Fprintln(d.Dest, a...)
+	return d.Dest
 }
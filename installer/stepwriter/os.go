@@ -4,8 +4,10 @@
 package stepwriter
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"os/exec"
@@ -13,6 +15,7 @@ import (
 
 	"github.com/livingsilver94/backee/installer"
 	"github.com/livingsilver94/backee/privilege"
+	"github.com/livingsilver94/backee/redact"
 	"github.com/livingsilver94/backee/service"
 )
 
@@ -20,16 +23,21 @@ func init() {
 	privilege.RegisterInterfaceImpl(symlinkWriter{})
 	privilege.RegisterInterfaceImpl(fileCopyWriter{})
 	privilege.RegisterInterfaceImpl(privilegedPathWriter{})
+	privilege.RegisterInterfaceImpl(privilegedPathRemover{})
 }
 
-type OS struct{}
+type OS struct {
+	// Stderr is where the standard error of scripts and package managers is written to.
+	// When nil, it defaults to [os.Stderr].
+	Stderr io.Writer
+}
 
-func (OS) Setup(script string) error {
-	return runScript(script)
+func (o OS) Setup(script string) error {
+	return runScript(o.stderr(), script)
 }
 
-func (OS) InstallPackages(fullCmd []string) error {
-	return runProcess(fullCmd[0], fullCmd[1:]...)
+func (o OS) InstallPackages(fullCmd []string) error {
+	return runProcess(o.stderr(), fullCmd[0], fullCmd[1:]...)
 }
 
 func (OS) SymlinkFile(dst service.FilePath, src string) error {
@@ -37,22 +45,89 @@ func (OS) SymlinkFile(dst service.FilePath, src string) error {
 }
 
 func (OS) CopyFile(dst service.FilePath, src installer.FileCopy) error {
-	return writePossiblyPrivilegedPath(dst, &fileCopyWriter{FileCopy: src})
+	// Render the file in this process, so that the privileged one
+	// receives its content through a pipe and doesn't need to decrypt it.
+	cont := &bytes.Buffer{}
+	_, err := src.WriteTo(cont)
+	if err != nil {
+		return err
+	}
+	return writePossiblyPrivilegedPath(dst, &fileCopyWriter{Content: cont.Bytes(), Mode: fs.FileMode(dst.Mode)})
+}
+
+func (o OS) Finalize(script string) error {
+	return runScript(o.stderr(), script)
+}
+
+func (o OS) Uninstall(script string) error {
+	return runScript(o.stderr(), script)
+}
+
+func (OS) RemoveSymlink(dst service.FilePath, src string) error {
+	info, err := os.Lstat(dst.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return fmt.Errorf("%s is not a symlink: %w", dst.Path, installer.ErrForeignFile)
+	}
+	wr := symlinkWriter{SrcPath: src}
+	eq, err := wr.isSymlinkEqual(dst.Path)
+	if err != nil {
+		return err
+	}
+	if !eq {
+		return fmt.Errorf("%s does not point to %s: %w", dst.Path, src, installer.ErrForeignFile)
+	}
+	return removePossiblyPrivilegedPath(dst)
+}
+
+func (OS) RemoveFile(dst service.FilePath) error {
+	err := removePossiblyPrivilegedPath(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
 }
 
-func (OS) Finalize(script string) error {
-	return runScript(script)
+// WithOutput implements installer.OutputWriter.
+func (o OS) WithOutput(wrap func(w io.Writer) io.Writer) installer.StepWriter {
+	o.Stderr = wrap(o.stderr())
+	return o
+}
+
+func (o OS) stderr() io.Writer {
+	if o.Stderr == nil {
+		return os.Stderr
+	}
+	return o.Stderr
 }
 
 type fileWriter interface {
 	writeFile(dst string) error
+	// isEqual returns whether dst is already what writeFile would write.
+	isEqual(dst string) (bool, error)
+	// defaultConflict is the conflict policy applied when none was requested.
+	defaultConflict() service.ConflictPolicy
 }
 
+// writePath writes dst with wr. If dst is left as it is, because it's
+// up to date or its conflict policy is skip, it returns installer.ErrNotWritten.
 func writePath(dst service.FilePath, wr fileWriter) error {
 	err := os.MkdirAll(filepath.Dir(dst.Path), 0755)
 	if err != nil {
 		return err
 	}
+	write, err := resolveConflict(dst, wr)
+	if err != nil {
+		return err
+	}
+	if !write {
+		return installer.ErrNotWritten
+	}
 	err = wr.writeFile(dst.Path)
 	if err != nil {
 		return err
@@ -63,9 +138,49 @@ func writePath(dst service.FilePath, wr fileWriter) error {
 	return nil
 }
 
+// resolveConflict applies the conflict policy of dst if it exists
+// and differs from what wr would write. It returns whether wr must write dst.
+func resolveConflict(dst service.FilePath, wr fileWriter) (bool, error) {
+	_, err := os.Lstat(dst.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return true, nil
+		}
+		return false, err
+	}
+	eq, err := wr.isEqual(dst.Path)
+	if err != nil {
+		return false, err
+	}
+	if eq {
+		return false, nil
+	}
+	policy := dst.Conflict
+	if policy == "" {
+		policy = wr.defaultConflict()
+	}
+	switch policy {
+	case service.ConflictSkip:
+		return false, nil
+	case service.ConflictOverwrite:
+		return true, os.Remove(dst.Path)
+	case service.ConflictBackup:
+		if dst.Backup == "" {
+			return false, fmt.Errorf("no backup path for %s", dst.Path)
+		}
+		return true, os.Rename(dst.Path, dst.Backup)
+	default:
+		return false, &fs.PathError{Op: "write", Path: dst.Path, Err: fs.ErrExist}
+	}
+}
+
 func writePathPrivileged(dst service.FilePath, wr fileWriter) error {
 	var r privilege.Runner = privilegedPathWriter{Dst: dst, Wr: wr}
-	return privilege.Run(r)
+	err := privilege.Run(r)
+	if errors.Is(err, privilege.ErrUnchanged) {
+		return installer.ErrNotWritten
+	}
+	return err
 }
 
 func writePossiblyPrivilegedPath(dst service.FilePath, wr fileWriter) error {
@@ -82,27 +197,55 @@ func writePossiblyPrivilegedPath(dst service.FilePath, wr fileWriter) error {
 	return nil
 }
 
-type symlinkWriter struct {
-	SrcPath string
+// removePath removes dst and restores its backup, if any.
+func removePath(dst service.FilePath) error {
+	err := os.Remove(dst.Path)
+	if err != nil {
+		return err
+	}
+	if dst.Backup == "" {
+		return nil
+	}
+	err = os.Rename(dst.Backup, dst.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
 }
 
-func (w symlinkWriter) writeFile(dst string) error {
-	err := os.Symlink(w.SrcPath, dst)
+func removePossiblyPrivilegedPath(dst service.FilePath) error {
+	err := removePath(dst)
 	if err != nil {
-		if !errors.Is(err, fs.ErrExist) {
-			return err
-		}
-		eq, errEq := w.isSymlinkEqual(dst)
-		if errEq != nil {
-			return errEq
-		}
-		if !eq {
+		if !errors.Is(err, fs.ErrPermission) {
 			return err
 		}
+		var r privilege.Runner = privilegedPathRemover{Dst: dst}
+		return privilege.Run(r)
 	}
 	return nil
 }
 
+type symlinkWriter struct {
+	SrcPath string
+}
+
+func (w symlinkWriter) writeFile(dst string) error {
+	return os.Symlink(w.SrcPath, dst)
+}
+
+func (w symlinkWriter) isEqual(dst string) (bool, error) {
+	eq, err := w.isSymlinkEqual(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Dangling symlink.
+		return false, nil
+	}
+	return eq, err
+}
+
+func (symlinkWriter) defaultConflict() service.ConflictPolicy {
+	return service.ConflictFail
+}
+
 func (w *symlinkWriter) isSymlinkEqual(dst string) (bool, error) {
 	eq, err := filepath.EvalSymlinks(dst)
 	if err != nil {
@@ -112,33 +255,78 @@ func (w *symlinkWriter) isSymlinkEqual(dst string) (bool, error) {
 }
 
 type fileCopyWriter struct {
-	FileCopy installer.FileCopy
+	// Content is the rendered content of the copied file.
+	Content []byte
+	// Mode is the permission the file is created with, if not zero.
+	Mode fs.FileMode
 }
 
 func (w fileCopyWriter) writeFile(dst string) error {
-	file, err := os.Create(dst)
+	// Create the file with its final permission, for secrets not to be readable meanwhile.
+	perm := w.Mode
+	if perm == 0 {
+		perm = 0666
+	}
+	file, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	_, err = w.FileCopy.WriteTo(file)
+	_, err = file.Write(w.Content)
+	if err1 := file.Close(); err == nil {
+		err = err1
+	}
 	return err
 }
 
+func (w fileCopyWriter) isEqual(dst string) (bool, error) {
+	info, err := os.Lstat(dst)
+	if err != nil || !info.Mode().IsRegular() {
+		return false, err
+	}
+	live, err := os.ReadFile(dst)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(live, w.Content), nil
+}
+
+func (fileCopyWriter) defaultConflict() service.ConflictPolicy {
+	return service.ConflictOverwrite
+}
+
 type privilegedPathWriter struct {
 	Dst service.FilePath
 	Wr  fileWriter
 }
 
 func (p privilegedPathWriter) RunPrivileged() error {
-	return writePath(p.Dst, p.Wr)
+	err := writePath(p.Dst, p.Wr)
+	if errors.Is(err, installer.ErrNotWritten) {
+		return privilege.ErrUnchanged
+	}
+	return err
+}
+
+type privilegedPathRemover struct {
+	Dst service.FilePath
+}
+
+func (p privilegedPathRemover) RunPrivileged() error {
+	err := removePath(p.Dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
 }
 
-func runProcess(name string, arg ...string) error {
+func runProcess(w io.Writer, name string, arg ...string) error {
+	// Scripts may print the secrets they are given.
+	stderr := redact.Default.Writer(w)
 	cmd := exec.Command(name, arg...)
 	cmd.Stdout = nil
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	return errors.Join(err, stderr.Flush())
 }
 
 type UnixID struct {
@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package stepwriter_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/livingsilver94/backee/installer"
+	"github.com/livingsilver94/backee/installer/stepwriter"
+	"github.com/livingsilver94/backee/repo"
+	"github.com/livingsilver94/backee/service"
+)
+
+func TestCopyFileConflict(t *testing.T) {
+	tests := []struct {
+		policy  service.ConflictPolicy
+		content string
+		err     error
+	}{
+		{policy: "", content: "new"},
+		{policy: service.ConflictOverwrite, content: "new"},
+		{policy: service.ConflictSkip, content: "old", err: installer.ErrNotWritten},
+		{policy: service.ConflictFail, content: "old", err: fs.ErrExist},
+		{policy: service.ConflictBackup, content: "new"},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src")
+		os.WriteFile(src, []byte("new"), 0644)
+		dst := service.FilePath{
+			Path:     filepath.Join(dir, "dst"),
+			Conflict: test.policy,
+			Backup:   filepath.Join(dir, "dst.bak"),
+		}
+		os.WriteFile(dst.Path, []byte("old"), 0644)
+
+		fc := installer.FileCopy{Src: src, Templ: installer.NewTemplate("srv", repo.NewVariables())}
+		err := stepwriter.OS{}.CopyFile(dst, fc)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%q: expected error %v. Got %v", test.policy, test.err, err)
+		}
+		cont, _ := os.ReadFile(dst.Path)
+		if string(cont) != test.content {
+			t.Fatalf("%q: expected content %q. Got %q", test.policy, test.content, cont)
+		}
+		_, err = os.Stat(dst.Backup)
+		if backedUp := err == nil; backedUp != (test.policy == service.ConflictBackup) {
+			t.Fatalf("%q: unexpected backup existence %t", test.policy, backedUp)
+		}
+	}
+}
+
+func TestSymlinkFileBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	os.WriteFile(src, nil, 0644)
+	dst := service.FilePath{
+		Path:     filepath.Join(dir, "dst"),
+		Conflict: service.ConflictBackup,
+		Backup:   filepath.Join(dir, "dst.bak"),
+	}
+	os.WriteFile(dst.Path, []byte("old"), 0644)
+
+	err := stepwriter.OS{}.SymlinkFile(dst, src)
+	if err != nil {
+		t.Skip("cannot create symlinks: ", err)
+	}
+	target, err := os.Readlink(dst.Path)
+	if err != nil || target != src {
+		t.Fatalf("expected a symlink to %s. Got %q, %v", src, target, err)
+	}
+
+	err = stepwriter.OS{}.RemoveSymlink(dst, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cont, err := os.ReadFile(dst.Path)
+	if err != nil || string(cont) != "old" {
+		t.Fatalf("expected backup to be restored. Got %q, %v", cont, err)
+	}
+}
@@ -7,12 +7,14 @@ package stepwriter
 
 import (
 	"fmt"
+	"io"
 	"io/fs"
 	"syscall"
 )
 
-func runScript(script string) error {
+func runScript(stderr io.Writer, script string) error {
 	return runProcess(
+		stderr,
 		"sh",
 		"-e", // Stop script on first error.
 		"-c", // Run the following script string.
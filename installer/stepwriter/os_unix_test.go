@@ -6,11 +6,20 @@
 package stepwriter_test
 
 import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 	"testing/fstest"
 
+	"filippo.io/age"
+	"github.com/livingsilver94/backee/installer"
 	"github.com/livingsilver94/backee/installer/stepwriter"
+	"github.com/livingsilver94/backee/repo"
+	"github.com/livingsilver94/backee/repo/solver"
+	"github.com/livingsilver94/backee/service"
 )
 
 func TestUnixIDsFS(t *testing.T) {
@@ -38,3 +47,62 @@ func TestRunAs(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestCopyFileEncrypted(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := solver.Encrypt("private key", id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "id_ed25519"+service.AgeExt)
+	os.WriteFile(src, []byte(enc), 0644)
+	dst := service.FilePath{Path: filepath.Join(dir, "id_ed25519"), Mode: 0o600}
+
+	fc := installer.FileCopy{
+		Src:       src,
+		Templ:     installer.NewTemplate("srv", repo.NewVariables()),
+		Decrypter: solver.NewAge(id),
+	}
+	err = stepwriter.OS{}.CopyFile(dst, fc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cont, _ := os.ReadFile(dst.Path)
+	if string(cont) != "private key" {
+		t.Fatalf("expected decrypted content %q. Got %q", "private key", cont)
+	}
+	info, err := os.Stat(dst.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("expected permission %o. Got %o", 0o600, perm)
+	}
+}
+
+func TestCopyFileUntouchedMode(t *testing.T) {
+	for _, old := range []string{"old", "new"} {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src")
+		os.WriteFile(src, []byte("new"), 0644)
+		dst := service.FilePath{Path: filepath.Join(dir, "dst"), Mode: 0o600, Conflict: service.ConflictSkip}
+		os.WriteFile(dst.Path, []byte(old), 0644)
+
+		fc := installer.FileCopy{Src: src, Templ: installer.NewTemplate("srv", repo.NewVariables())}
+		err := stepwriter.OS{}.CopyFile(dst, fc)
+		if !errors.Is(err, installer.ErrNotWritten) {
+			t.Fatalf("%q: expected error %v. Got %v", old, installer.ErrNotWritten, err)
+		}
+		info, err := os.Stat(dst.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0644 {
+			t.Fatalf("%q: expected mode %v to be unchanged. Got %v", old, fs.FileMode(0644), info.Mode().Perm())
+		}
+	}
+}
@@ -6,11 +6,13 @@
 package stepwriter
 
 import (
+	"io"
 	"io/fs"
 )
 
-func runScript(script string) error {
+func runScript(stderr io.Writer, script string) error {
 	return runProcess(
+		stderr,
 		"powershell",
 		"-NoLogo",  // Hide copyright banner.
 		"-Command", // Run the following script string.
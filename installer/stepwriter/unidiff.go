@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package stepwriter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines surrounding a change in a hunk.
+const diffContext = 3
+
+type diffOp byte
+
+const (
+	opEqual  diffOp = ' '
+	opDelete diffOp = '-'
+	opInsert diffOp = '+'
+)
+
+type diffEdit struct {
+	op   diffOp
+	line string
+}
+
+// writeUnifiedDiff writes the unified diff that turns from into to.
+// Nothing is written if the two texts are equal.
+func writeUnifiedDiff(w io.Writer, fromName, toName, from, to string) error {
+	edits := diffLines(splitLines(from), splitLines(to))
+	changed := false
+	for _, e := range edits {
+		if e.op != opEqual {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", fromName, toName)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(edits); {
+		first := nextChange(edits, start)
+		if first < 0 {
+			break
+		}
+		last := first
+		for {
+			next := nextChange(edits, last+1)
+			if next < 0 || next-last > 2*diffContext {
+				break
+			}
+			last = next
+		}
+		hunkStart := max(first-diffContext, start)
+		hunkEnd := min(last+diffContext+1, len(edits))
+		err := writeHunk(w, edits, hunkStart, hunkEnd)
+		if err != nil {
+			return err
+		}
+		start = hunkEnd
+	}
+	return nil
+}
+
+func writeHunk(w io.Writer, edits []diffEdit, start, end int) error {
+	fromLine, toLine := 1, 1
+	for _, e := range edits[:start] {
+		if e.op != opInsert {
+			fromLine++
+		}
+		if e.op != opDelete {
+			toLine++
+		}
+	}
+	fromLen, toLen := 0, 0
+	for _, e := range edits[start:end] {
+		if e.op != opInsert {
+			fromLen++
+		}
+		if e.op != opDelete {
+			toLen++
+		}
+	}
+	if fromLen == 0 {
+		fromLine--
+	}
+	if toLen == 0 {
+		toLine--
+	}
+	_, err := fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", fromLine, fromLen, toLine, toLen)
+	if err != nil {
+		return err
+	}
+	for _, e := range edits[start:end] {
+		_, err = fmt.Fprintf(w, "%c%s", e.op, e.line)
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(e.line, "\n") {
+			_, err = io.WriteString(w, "\n\\ No newline at end of file\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func nextChange(edits []diffEdit, from int) int {
+	for i := from; i < len(edits); i++ {
+		if edits[i].op != opEqual {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitLines splits s into lines, each keeping its line terminator.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script from a to b,
+// computed with Myers' algorithm.
+func diffLines(a, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		found := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	// Walk the trace backwards to rebuild the path.
+	edits := make([]diffEdit, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		vd := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && vd[offset+k-1] < vd[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := vd[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, diffEdit{op: opEqual, line: a[x-1]})
+			x--
+			y--
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			edits = append(edits, diffEdit{op: opInsert, line: b[y-1]})
+			y--
+		} else {
+			edits = append(edits, diffEdit{op: opDelete, line: a[x-1]})
+			x--
+		}
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package stepwriter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		from, to string
+		out      string
+	}{
+		{from: "a\nb\n", to: "a\nb\n", out: ""},
+		{
+			from: "a\nb\nc\n",
+			to:   "a\nB\nc\n",
+			out:  "--- from\n+++ to\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			from: "",
+			to:   "new\n",
+			out:  "--- from\n+++ to\n@@ -0,0 +1,1 @@\n+new\n",
+		},
+		{
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			to:   "1\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			out:  "--- from\n+++ to\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			from: "a",
+			to:   "a\n",
+			out:  "--- from\n+++ to\n@@ -1,1 +1,1 @@\n-a\n\\ No newline at end of file\n+a\n",
+		},
+	}
+	for _, test := range tests {
+		out := &strings.Builder{}
+		err := writeUnifiedDiff(out, "from", "to", test.from, test.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.out {
+			t.Fatalf("expected diff %q. Got %q", test.out, out.String())
+		}
+	}
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	to := "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n"
+	out := &strings.Builder{}
+	err := writeUnifiedDiff(out, "from", "to", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.String(), "@@ -"); n != 2 {
+		t.Fatalf("expected 2 hunks. Got %d in %q", n, out.String())
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"io"
+	"sort"
 	"strings"
 
 	"github.com/livingsilver94/backee/repo"
@@ -88,16 +89,47 @@ func (t *Template) GobDecode(data []byte) error {
 	return nil
 }
 
+// Unreplace is the inverse of Replace: it turns the values of the variables
+// named in names back into placeholders. Longer values are replaced first.
+// Names that don't match any variable, or whose value is empty, are ignored.
+func (t Template) Unreplace(s string, names []string) string {
+	type pair struct{ value, tag string }
+	pairs := make([]pair, 0, len(names))
+	for _, name := range names {
+		val, err := t.value(name)
+		if err != nil || val == "" {
+			continue
+		}
+		pairs = append(pairs, pair{value: val, tag: service.VarOpenTag + name + service.VarCloseTag})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return len(pairs[i].value) > len(pairs[j].value) })
+	oldNew := make([]string, 0, len(pairs)*2)
+	for _, p := range pairs {
+		oldNew = append(oldNew, p.value, p.tag)
+	}
+	return strings.NewReplacer(oldNew...).Replace(s)
+}
+
 func (t Template) replaceTag(w io.Writer, varName string) (int, error) {
+	val, err := t.value(varName)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write([]byte(val))
+}
+
+// value returns the value of varName, which is either a variable local
+// to the service, a common variable or a variable of a parent service.
+func (t Template) value(varName string) (string, error) {
 	val, err := t.variables.Get(t.serviceName, varName)
 	if err == nil {
 		// Matched a variable local to the service.
-		return w.Write([]byte(val))
+		return val, nil
 	}
 
 	parentName, parentVar, found := strings.Cut(varName, service.VarParentSep)
 	if !found {
-		return 0, err
+		return "", err
 	}
 	parents, _ := t.variables.Parents(t.serviceName)
 	for _, parent := range parents {
@@ -106,11 +138,11 @@ func (t Template) replaceTag(w io.Writer, varName string) (int, error) {
 		}
 		if val, ok := t.variables.Get(parent, parentVar); ok == nil {
 			// Matched a parent service variable.
-			return w.Write([]byte(val))
+			return val, nil
 		}
 		break
 	}
-	return 0, err
+	return "", err
 }
 
 // greedyTagSplitter is a bufio.SplitFunc that reads
@@ -100,6 +100,18 @@ func TestReplaceReader(t *testing.T) {
 	}
 }
 
+func TestUnreplace(t *testing.T) {
+	vars := createVariables("short", "foo", "long", "foobar", "unused", "baz")
+	repl := installer.NewTemplate(serviceName, vars)
+
+	const s = "foobar foo baz"
+	const expected = "{{long}} {{short}} baz"
+	obtained := repl.Unreplace(s, []string{"short", "long", "notAVariable"})
+	if obtained != expected {
+		t.Fatalf("expected string %q. Got %q", expected, obtained)
+	}
+}
+
 func TestGobCodec(t *testing.T) {
 	expected := installer.NewTemplate(serviceName, createVariables("var1", "value1"))
 
@@ -9,15 +9,21 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
+	"github.com/livingsilver94/backee/redact"
 )
 
 // LogHandler is a slog handler with a focus on readability and aesthetics,
 // although it sacrifices parsability a little.
 type LogHandler struct {
 	dest *bufio.Writer
+	// redacted masks secrets in what dest flushes.
+	redacted *redact.Writer
+	// mu guards dest, which is shared by all derived handlers.
+	mu *sync.Mutex
 	// group is a string idenfying a particular context while logging.
 	group string
 	// attribs is a collection of default attributes to be logged.
@@ -33,9 +39,12 @@ func NewLogHandler(dest io.Writer, op *LogHandlerOptions) LogHandler {
 	} else {
 		opts = DefaultHandlerOptions()
 	}
+	redacted := redact.Default.Writer(dest)
 	return LogHandler{
-		dest: bufio.NewWriter(dest),
-		opts: opts,
+		dest:     bufio.NewWriter(redacted),
+		redacted: redacted,
+		mu:       &sync.Mutex{},
+		opts:     opts,
 	}
 }
 
@@ -46,6 +55,8 @@ func (h LogHandler) Enabled(_ context.Context, level slog.Level) bool {
 
 // Handle implements slog.Handler's Handle function.
 func (h LogHandler) Handle(_ context.Context, rec slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	err := h.printPrefix(rec.Time)
 	if err != nil {
 		return err
@@ -62,26 +73,34 @@ func (h LogHandler) Handle(_ context.Context, rec slog.Record) error {
 	if err != nil {
 		return err
 	}
-	return h.dest.Flush()
+	err = h.dest.Flush()
+	if err != nil {
+		return err
+	}
+	return h.redacted.Flush()
 }
 
 // WithAttrs implements slog.Handler's WithAttrs function.
 func (h LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	return LogHandler{
-		dest:    h.dest,
-		group:   h.group,
-		attribs: append(h.attribs, attrs...),
-		opts:    h.opts,
+		dest:     h.dest,
+		redacted: h.redacted,
+		mu:       h.mu,
+		group:    h.group,
+		attribs:  append(h.attribs, attrs...),
+		opts:     h.opts,
 	}
 }
 
 // WithGroup implements slog.Handler's WithGroup function.
 func (h LogHandler) WithGroup(group string) slog.Handler {
 	return LogHandler{
-		dest:    h.dest,
-		group:   group,
-		attribs: h.attribs,
-		opts:    h.opts,
+		dest:     h.dest,
+		redacted: h.redacted,
+		mu:       h.mu,
+		group:    group,
+		attribs:  h.attribs,
+		opts:     h.opts,
 	}
 }
 
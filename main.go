@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"github.com/livingsilver94/backee/cli"
+	"github.com/livingsilver94/backee/redact"
 )
 
 func main() {
@@ -19,6 +20,9 @@ func main() {
 	if globals.Quiet {
 		logOpt.Level = slog.LevelError
 	}
+	if globals.ShowSecrets {
+		redact.Default.Disable()
+	}
 	slog.SetDefault(slog.New(NewLogHandler(os.Stdout, &logOpt)))
 
 	err := ctx.Run()
@@ -0,0 +1,213 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package pkgmanager provides drivers for operating system package managers.
+package pkgmanager
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrUnknown  = errors.New("unknown package manager")
+	ErrNotFound = errors.New("no package manager found")
+)
+
+// PackageManager installs operating system packages.
+type PackageManager interface {
+	// Name identifies the package manager. Services use it
+	// to name packages differently for each package manager.
+	Name() string
+	// Installed returns which of pkgs are already installed.
+	Installed(pkgs []string) ([]string, error)
+	// InstallCommand returns the command that installs pkgs.
+	InstallCommand(pkgs []string) []string
+}
+
+// Runner runs commands on behalf of package managers.
+type Runner interface {
+	// LookPath searches for an executable named file.
+	LookPath(file string) (string, error)
+	// Output runs a command and returns its standard output.
+	Output(name string, arg ...string) ([]byte, error)
+}
+
+// OSRunner is a Runner for the operating system's commands.
+type OSRunner struct{}
+
+func (OSRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func (OSRunner) Output(name string, arg ...string) ([]byte, error) {
+	return exec.Command(name, arg...).Output()
+}
+
+// Names returns the names of the built-in package managers.
+func Names() []string {
+	names := make([]string, 0, len(drivers))
+	for _, drv := range drivers {
+		names = append(names, drv.name)
+	}
+	return names
+}
+
+// New returns the built-in package manager named name.
+func New(name string, r Runner) (PackageManager, error) {
+	for _, drv := range drivers {
+		if drv.name == name {
+			return newManager(drv, r), nil
+		}
+	}
+	return nil, fmt.Errorf("%q: %w", name, ErrUnknown)
+}
+
+// Detect returns the first built-in package manager whose executable is found.
+// Package managers that complement the system one, such as flatpak, are never detected.
+// The generic pkcon driver is tried last, so it only serves systems without a more specific one.
+func Detect(r Runner) (PackageManager, error) {
+	for _, drv := range drivers {
+		if drv.complementary {
+			continue
+		}
+		_, err := r.LookPath(drv.install[0])
+		if err == nil {
+			return newManager(drv, r), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// driver describes how to operate a package manager.
+type driver struct {
+	name string
+	// query is the command that lists installed packages, one per line.
+	// When nil, no package is reported as installed.
+	query []string
+	// parse extracts a package name from a line printed by query.
+	// Lines for which it returns false are skipped.
+	// When nil, each line is a package name.
+	parse   func(line string) (string, bool)
+	install []string
+	// root reports whether install requires administrative privileges.
+	root bool
+	// complementary reports whether the package manager
+	// is not meant to replace the system's one.
+	complementary bool
+}
+
+var rpmQuery = []string{"rpm", "-qa", "--queryformat", "%{NAME}\n"}
+
+// drivers are the built-in drivers, in order of detection.
+var drivers = []driver{
+	{name: "dnf", query: rpmQuery, install: []string{"dnf", "install", "-y"}, root: true},
+	{name: "zypper", query: rpmQuery, install: []string{"zypper", "--non-interactive", "install"}, root: true},
+	{
+		name:    "apt",
+		query:   []string{"dpkg-query", "--show", "--showformat", "${db:Status-Abbrev} ${Package}\n"},
+		parse:   parseDpkg,
+		install: []string{"apt-get", "install", "-y"},
+		root:    true,
+	},
+	{name: "pacman", query: []string{"pacman", "-Qq"}, install: []string{"pacman", "-S", "--needed", "--noconfirm"}, root: true},
+	{name: "apk", query: []string{"apk", "info"}, install: []string{"apk", "add"}, root: true},
+	{name: "brew", query: []string{"brew", "list", "-1"}, install: []string{"brew", "install"}},
+	{
+		name:          "flatpak",
+		query:         []string{"flatpak", "list", "--columns=application"},
+		install:       []string{"flatpak", "install", "-y", "--noninteractive"},
+		complementary: true,
+	},
+	// pkcon is PackageKit's generic client, tried when the system's
+	// own package manager has no driver.
+	{name: "pkcon", install: []string{"pkcon", "install", "-y"}},
+}
+
+// parseDpkg parses a line of dpkg-query, keeping installed packages only.
+func parseDpkg(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 || fields[0] != "ii" {
+		return "", false
+	}
+	return fields[1], true
+}
+
+// elevationUtils are the commands that grant administrative privileges,
+// in order of preference.
+var elevationUtils = []string{"sudo", "doas"}
+
+// geteuid is swapped in tests.
+var geteuid = os.Geteuid
+
+type manager struct {
+	driver
+	runner Runner
+	// elevate precedes the install command, if not empty.
+	elevate string
+}
+
+func newManager(drv driver, r Runner) manager {
+	man := manager{driver: drv, runner: r}
+	if !drv.root || geteuid() == 0 {
+		return man
+	}
+	for _, util := range elevationUtils {
+		_, err := r.LookPath(util)
+		if err == nil {
+			man.elevate = util
+			break
+		}
+	}
+	return man
+}
+
+func (m manager) Name() string {
+	return m.name
+}
+
+func (m manager) Installed(pkgs []string) ([]string, error) {
+	if m.query == nil {
+		return nil, nil
+	}
+	out, err := m.runner.Output(m.query[0], m.query[1:]...)
+	if err != nil {
+		return nil, fmt.Errorf("listing packages installed by %s: %w", m.name, err)
+	}
+	all := make(map[string]struct{})
+	scan := bufio.NewScanner(bytes.NewReader(out))
+	for scan.Scan() {
+		name, ok := strings.TrimSpace(scan.Text()), true
+		if m.parse != nil {
+			name, ok = m.parse(name)
+		}
+		if ok && name != "" {
+			all[name] = struct{}{}
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	var installed []string
+	for _, pkg := range pkgs {
+		if _, ok := all[pkg]; ok && !slices.Contains(installed, pkg) {
+			installed = append(installed, pkg)
+		}
+	}
+	return installed, nil
+}
+
+func (m manager) InstallCommand(pkgs []string) []string {
+	cmd := make([]string, 0, len(m.install)+len(pkgs)+1)
+	if m.elevate != "" {
+		cmd = append(cmd, m.elevate)
+	}
+	cmd = append(cmd, m.install...)
+	return append(cmd, pkgs...)
+}
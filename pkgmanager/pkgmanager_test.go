@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package pkgmanager
+
+import (
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeRunner finds executables in paths, and returns
+// outputs for commands, keyed by their command line.
+type fakeRunner struct {
+	paths   []string
+	outputs map[string]string
+}
+
+func (r fakeRunner) LookPath(file string) (string, error) {
+	if slices.Contains(r.paths, file) {
+		return "/usr/bin/" + file, nil
+	}
+	return "", exec.ErrNotFound
+}
+
+func (r fakeRunner) Output(name string, arg ...string) ([]byte, error) {
+	out, ok := r.outputs[strings.Join(append([]string{name}, arg...), " ")]
+	if !ok {
+		return nil, errors.New("unexpected command")
+	}
+	return []byte(out), nil
+}
+
+func asUser(t *testing.T, uid int) {
+	orig := geteuid
+	geteuid = func() int { return uid }
+	t.Cleanup(func() { geteuid = orig })
+}
+
+func TestDetect(t *testing.T) {
+	asUser(t, 0)
+	pm, err := Detect(fakeRunner{paths: []string{"flatpak", "apt-get", "brew"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pm.Name() != "apt" {
+		t.Fatalf("expected apt. Got %s", pm.Name())
+	}
+}
+
+func TestDetectPackageKit(t *testing.T) {
+	asUser(t, 1000)
+	pm, err := Detect(fakeRunner{paths: []string{"flatpak", "pkcon", "sudo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pm.Name() != "pkcon" {
+		t.Fatalf("expected pkcon. Got %s", pm.Name())
+	}
+	installed, err := pm.Installed([]string{"vim"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if installed != nil {
+		t.Fatalf("expected no installed packages. Got %v", installed)
+	}
+	expected := []string{"pkcon", "install", "-y", "vim"}
+	if cmd := pm.InstallCommand([]string{"vim"}); !slices.Equal(cmd, expected) {
+		t.Fatalf("expected %v. Got %v", expected, cmd)
+	}
+}
+
+func TestDetectNotFound(t *testing.T) {
+	_, err := Detect(fakeRunner{paths: []string{"flatpak"}})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v. Got %v", ErrNotFound, err)
+	}
+}
+
+func TestNewUnknown(t *testing.T) {
+	_, err := New("portage", fakeRunner{})
+	if !errors.Is(err, ErrUnknown) {
+		t.Fatalf("expected %v. Got %v", ErrUnknown, err)
+	}
+}
+
+func TestInstalled(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		output string
+	}{
+		{name: "dnf", query: "rpm -qa --queryformat %{NAME}\n", output: "vim\nbash\nzsh\n"},
+		{name: "apt", query: "dpkg-query --show --showformat ${db:Status-Abbrev} ${Package}\n", output: "ii  vim\nrc  nano\nii  zsh\n"},
+		{name: "pacman", query: "pacman -Qq", output: "vim\nzsh\n"},
+		{name: "flatpak", query: "flatpak list --columns=application", output: "org.gnome.Maps\nzsh\nvim\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pm, err := New(test.name, fakeRunner{outputs: map[string]string{test.query: test.output}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			installed, err := pm.Installed([]string{"zsh", "nano", "vim"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []string{"zsh", "vim"}
+			if !slices.Equal(installed, expected) {
+				t.Fatalf("expected installed packages %v. Got %v", expected, installed)
+			}
+		})
+	}
+}
+
+func TestInstallCommand(t *testing.T) {
+	asUser(t, 1000)
+	pm, err := New("dnf", fakeRunner{paths: []string{"doas"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"doas", "dnf", "install", "-y", "vim", "zsh"}
+	if cmd := pm.InstallCommand([]string{"vim", "zsh"}); !slices.Equal(cmd, expected) {
+		t.Fatalf("expected command %q. Got %q", expected, cmd)
+	}
+
+	pm, err = New("brew", fakeRunner{paths: []string{"sudo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"brew", "install", "vim"}
+	if cmd := pm.InstallCommand([]string{"vim"}); !slices.Equal(cmd, expected) {
+		t.Fatalf("expected command %q. Got %q", expected, cmd)
+	}
+}
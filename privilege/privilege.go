@@ -15,8 +15,15 @@ const (
 
 var (
 	ErrNoElevUtil = errors.New("no privilege elevation utility found")
+	// ErrUnchanged is returned by a Runner that deliberately changed nothing.
+	// Run returns it too, when the privileged Runner does.
+	ErrUnchanged = errors.New("nothing changed")
 )
 
+// ExitUnchanged is the exit code of the privileged process
+// when its Runner returns ErrUnchanged.
+const ExitUnchanged = 3
+
 var (
 	elevationUtils = []string{"sudo", "doas"}
 )
@@ -48,6 +55,10 @@ func Run(run Runner) (err error) {
 				cmd.Process.Kill()
 			} else {
 				err = cmd.Wait()
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) && exitErr.ExitCode() == ExitUnchanged {
+					err = ErrUnchanged
+				}
 			}
 		}()
 		return SendRunner(pWrite, run)
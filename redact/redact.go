@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package redact masks secrets in text meant for humans,
+// such as logs and previews of the files to be written.
+package redact
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask replaces secrets.
+const Mask = "********"
+
+// minLen is the length under which secrets aren't masked,
+// since they would mask ordinary text as well.
+const minLen = 4
+
+// Default is the Redactor of secret variables.
+var Default = &Redactor{}
+
+// Redactor masks the secrets added to it. It is safe for concurrent use.
+// The zero value is an enabled Redactor without secrets.
+type Redactor struct {
+	mu       sync.RWMutex
+	secrets  []string
+	replacer *strings.Replacer
+	disabled bool
+}
+
+// Add adds secret to the secrets to mask. Each line of a multi-line
+// secret is masked on its own too, for secrets split across log lines.
+// Secrets and lines shorter than 4 bytes, blanks aside, are ignored.
+func (r *Redactor) Add(secret string) {
+	if len(strings.TrimSpace(secret)) < minLen {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	news := []string{secret}
+	if strings.Contains(secret, "\n") {
+		for _, line := range strings.Split(secret, "\n") {
+			if line = strings.TrimSpace(line); len(line) >= minLen {
+				news = append(news, line)
+			}
+		}
+	}
+	for _, s := range news {
+		i := sort.SearchStrings(r.secrets, s)
+		if i < len(r.secrets) && r.secrets[i] == s {
+			continue
+		}
+		r.secrets = append(r.secrets, "")
+		copy(r.secrets[i+1:], r.secrets[i:])
+		r.secrets[i] = s
+	}
+	// Longer secrets first, for them to be masked entirely
+	// when they contain shorter ones.
+	bySize := make([]string, len(r.secrets))
+	copy(bySize, r.secrets)
+	sort.SliceStable(bySize, func(i, j int) bool { return len(bySize[i]) > len(bySize[j]) })
+	pairs := make([]string, 0, 2*len(bySize))
+	for _, s := range bySize {
+		pairs = append(pairs, s, Mask)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// Disable makes r leave secrets visible.
+func (r *Redactor) Disable() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.disabled = true
+}
+
+// String returns s with secrets replaced by Mask.
+func (r *Redactor) String(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.disabled || r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// safeCut returns how much of s can be masked and written right away:
+// the rest may be the beginning of a secret, or the end of one that begins earlier.
+func (r *Redactor) safeCut(s string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.disabled {
+		return len(s)
+	}
+	cut := len(s)
+	for _, secret := range r.secrets {
+		for n := min(len(secret)-1, len(s)); n > len(s)-cut; n-- {
+			if strings.HasPrefix(secret, s[len(s)-n:]) {
+				cut = len(s) - n
+				break
+			}
+		}
+	}
+	for moved := true; moved; {
+		moved = false
+		for _, secret := range r.secrets {
+			for i := max(0, cut-len(secret)+1); i < cut; i++ {
+				if strings.HasPrefix(s[i:], secret) {
+					cut, moved = i, true
+					break
+				}
+			}
+		}
+	}
+	return cut
+}
+
+// Writer returns a Writer that masks secrets written to w.
+func (r *Redactor) Writer(w io.Writer) *Writer {
+	return &Writer{r: r, dst: w}
+}
+
+// Writer masks secrets in what it writes to an underlying writer.
+// Text that may be the beginning of a secret is held until
+// the next write or Flush, so that secrets split across writes are masked.
+type Writer struct {
+	r   *Redactor
+	dst io.Writer
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Write implements the io.Writer interface.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	cut := w.r.safeCut(string(w.buf))
+	_, err := io.WriteString(w.dst, w.r.String(string(w.buf[:cut])))
+	w.buf = w.buf[:copy(w.buf, w.buf[cut:])]
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes the text held, if any.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.dst, w.r.String(string(w.buf)))
+	w.buf = w.buf[:0]
+	return err
+}
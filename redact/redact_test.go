@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package redact_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/livingsilver94/backee/redact"
+)
+
+func TestString(t *testing.T) {
+	var r redact.Redactor
+	r.Add("hunter2")
+	r.Add("hunter22")
+	r.Add("line1\nline2")
+	r.Add("  ")
+	r.Add("on")
+	r.Add("a\nlonger")
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{text: "password hunter2.", expected: "password ********."},
+		{text: "password hunter22", expected: "password ********"},
+		{text: "key:\nline1\nline2\n", expected: "key:\n********\n"},
+		{text: "only line2 here", expected: "only ******** here"},
+		{text: "nothing  secret", expected: "nothing  secret"},
+		{text: "turn on a light", expected: "turn on a light"},
+		{text: "a longer one", expected: "a ******** one"},
+	}
+	for _, test := range tests {
+		if obtained := r.String(test.text); obtained != test.expected {
+			t.Fatalf("expected %q. Got %q", test.expected, obtained)
+		}
+	}
+	r.Disable()
+	if obtained := r.String("hunter2"); obtained != "hunter2" {
+		t.Fatalf("expected a disabled redactor to keep secrets. Got %q", obtained)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var r redact.Redactor
+	r.Add("hunter2")
+	r.Add("ter2xyz")
+	tests := []struct {
+		writes   []string
+		expected string
+	}{
+		{writes: []string{"pass: hun", "ter2\n"}, expected: "pass: ********\n"},
+		{writes: []string{"h", "u", "n", "t", "e", "r", "2"}, expected: "********"},
+		{writes: []string{"hunter2", "xyz"}, expected: "********xyz"},
+		{writes: []string{"a hunt"}, expected: "a hunt"},
+	}
+	for _, test := range tests {
+		out := &strings.Builder{}
+		w := r.Writer(out)
+		for _, s := range test.writes {
+			_, err := w.Write([]byte(s))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(out.String(), "hun") && strings.Contains(out.String(), "ter2") {
+				t.Fatalf("secret written after %q: %q", s, out.String())
+			}
+		}
+		err := w.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.expected {
+			t.Fatalf("expected %q for writes %q. Got %q", test.expected, test.writes, out.String())
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFilename is the name of the configuration file of a repository, in its root.
+const ConfigFilename = "backee.yaml"
+
+// Config is the configuration of a repository.
+type Config struct {
+	// Exec maps the names of external secret managers
+	// to the command that reads one of their secrets.
+	Exec map[string]Command `yaml:"exec"`
+	// Age configures the encryption of secrets.
+	Age AgeConfig `yaml:"age"`
+}
+
+// AgeConfig configures the encryption of secrets with age.
+type AgeConfig struct {
+	// Recipients are the public keys that secrets are encrypted for, such as "age1...".
+	Recipients []string `yaml:"recipients"`
+}
+
+// Command is a program followed by its arguments.
+// In YAML, it is either a sequence or a string of arguments separated by white space.
+type Command []string
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *Command) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var line string
+		err := node.Decode(&line)
+		if err != nil {
+			return err
+		}
+		*c = strings.Fields(line)
+	default:
+		var args []string
+		err := node.Decode(&args)
+		if err != nil {
+			return err
+		}
+		*c = args
+	}
+	return nil
+}
+
+// Config returns the configuration of the repository.
+// It is empty if the repository has no ConfigFilename.
+func (repo FS) Config() (Config, error) {
+	var conf Config
+	data, err := fs.ReadFile(repo.baseFS, ConfigFilename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return conf, nil
+		}
+		return conf, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(&conf)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return conf, fmt.Errorf("%s: %w", ConfigFilename, err)
+	}
+	for name, cmd := range conf.Exec {
+		if len(cmd) == 0 {
+			return conf, fmt.Errorf("%s: exec backend %q has no command", ConfigFilename, name)
+		}
+	}
+	return conf, nil
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo_test
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/livingsilver94/backee/repo"
+)
+
+func TestConfig(t *testing.T) {
+	const doc = `
+exec:
+  bw: bw get password {}
+  vault: [vault, kv, get, "-field=password", "{}"]`
+	fsys := fstest.MapFS{repo.ConfigFilename: &fstest.MapFile{Data: []byte(doc)}}
+	conf, err := repo.NewFS(fsys).Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]repo.Command{
+		"bw":    {"bw", "get", "password", "{}"},
+		"vault": {"vault", "kv", "get", "-field=password", "{}"},
+	}
+	if !reflect.DeepEqual(conf.Exec, expected) {
+		t.Fatalf("expected exec backends %v. Got %v", expected, conf.Exec)
+	}
+}
+
+func TestConfigMissing(t *testing.T) {
+	conf, err := repo.NewFS(fstest.MapFS{}).Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Exec != nil {
+		t.Fatalf("expected no exec backends. Got %v", conf.Exec)
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	for _, doc := range []string{"unknown: 1", "exec: {bw: []}"} {
+		fsys := fstest.MapFS{repo.ConfigFilename: &fstest.MapFile{Data: []byte(doc)}}
+		_, err := repo.NewFS(fsys).Config()
+		if err == nil {
+			t.Fatalf("expected an error for %q", doc)
+		}
+	}
+}
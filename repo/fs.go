@@ -8,8 +8,12 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/livingsilver94/backee/service"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -22,76 +26,180 @@ const (
 
 // FS is a repository based on a filesystem.
 type FS struct {
-	baseFS  fs.FS
-	variant string
+	baseFS fs.FS
+	// variants are the candidate system variants, most specific first.
+	variants []string
 }
 
 // NewFS creates a new filesystem-based repository from an existing filesystem.
 func NewFS(baseFS fs.FS) FS {
 	return FS{
-		baseFS:  baseFS,
-		variant: "",
+		baseFS: baseFS,
 	}
 }
 
 // NewFSVariant creates a new FS repository from an existing filesystem.
 // The new FS repository will return services for the given system variant.
 func NewFSVariant(baseFS fs.FS, variant string) FS {
+	return NewFSVariants(baseFS, variant)
+}
+
+// NewFSVariants creates a new FS repository from an existing filesystem.
+// variants are candidate system variants, most specific first.
+// The files of all variants that exist are merged over the file without variant.
+func NewFSVariants(baseFS fs.FS, variants ...string) FS {
 	return FS{
-		baseFS:  baseFS,
-		variant: variant,
+		baseFS:   baseFS,
+		variants: variants,
 	}
 }
 
 // Service returns the service with the name provided.
+// Its definition is the merge of its layers, as in ServiceLayers,
+// and its variables include its Secrets.
 func (repo FS) Service(name string) (*service.Service, error) {
-	var fname string
-	if repo.variant != "" {
-		fname = name + "/" + (fsRepoFilenamePrefix + "_" + repo.variant + fsRepoFilenameSuffix)
-	} else {
-		fname = name + "/" + (fsRepoFilenamePrefix + fsRepoFilenameSuffix)
-	}
-	file, err := repo.baseFS.Open(fname)
+	node, _, err := repo.ServiceNode(name)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	return service.NewFromYAMLReader(name, file)
+	srv := service.New(name)
+	if node != nil {
+		err = node.Decode(srv)
+		if err != nil {
+			return srv, err
+		}
+	}
+	return srv, repo.addSecrets(srv)
+}
+
+// ServiceNode returns the YAML document that defines the service named name,
+// merging its layers and the fragments they include, along with the paths
+// of the files merged, in order. Each fragment is merged once, before
+// the first file that includes it.
+// The document is nil if all files are empty.
+func (repo FS) ServiceNode(name string) (*yaml.Node, []string, error) {
+	layers, err := repo.ServiceLayers(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		merged *yaml.Node
+		files  = make([]string, 0, len(layers))
+	)
+	for _, layer := range layers {
+		node, err := repo.loadLayer(layer, nil, &files)
+		if err != nil {
+			return nil, nil, err
+		}
+		merged = service.MergeYAML(merged, node)
+	}
+	return merged, files, nil
+}
+
+// ServiceLayers returns the paths of the files that define the service
+// named name, relative to the repository's root. The file without variant,
+// if any, comes first, followed by the files of the variants from the least specific.
+// Later layers are merged over earlier ones.
+func (repo FS) ServiceLayers(name string) ([]string, error) {
+	fnames := make([]string, 0, len(repo.variants)+1)
+	fnames = append(fnames, name+"/"+(fsRepoFilenamePrefix+fsRepoFilenameSuffix))
+	for i := len(repo.variants) - 1; i >= 0; i-- {
+		if repo.variants[i] == "" {
+			continue
+		}
+		fnames = append(fnames, name+"/"+(fsRepoFilenamePrefix+"_"+repo.variants[i]+fsRepoFilenameSuffix))
+	}
+	layers := fnames[:0]
+	for _, fname := range fnames {
+		_, err := fs.Stat(repo.baseFS, fname)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		layers = append(layers, fname)
+	}
+	if len(layers) == 0 {
+		return nil, &fs.PathError{Op: "open", Path: fnames[0], Err: fs.ErrNotExist}
+	}
+	return layers, nil
 }
 
 // AllServices returns all services in the filesystem.
 func (repo FS) AllServices() ([]*service.Service, error) {
+	names, err := repo.ServiceNames()
+	if err != nil {
+		return nil, err
+	}
+	services := make([]*service.Service, 0, len(names))
+	for _, name := range names {
+		srv, err := repo.Service(name)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, srv)
+	}
+	return services, nil
+}
+
+// ServiceNames returns the names of all services in the filesystem, without parsing them.
+// Directories whose name starts with an underscore hold
+// fragments to include, and are not services.
+func (repo FS) ServiceNames() ([]string, error) {
 	children, err := fs.ReadDir(repo.baseFS, ".")
 	if err != nil {
 		return nil, err
 	}
-	services := make([]*service.Service, 0, len(children))
+	var names []string
 	for _, child := range children {
-		if !child.IsDir() {
+		if !child.IsDir() || strings.HasPrefix(child.Name(), "_") {
 			continue
 		}
-		srv, err := repo.Service(child.Name())
+		_, err := repo.ServiceLayers(child.Name())
 		if err != nil {
 			if errors.Is(err, fs.ErrNotExist) {
 				continue
 			}
 			return nil, err
 		}
-		services = append(services, srv)
+		names = append(names, child.Name())
 	}
-	return services, nil
+	return names, nil
+}
+
+// Dependents returns all services in the filesystem that directly depend on name.
+func (repo FS) Dependents(name string) ([]*service.Service, error) {
+	all, err := repo.AllServices()
+	if err != nil {
+		return nil, err
+	}
+	var dependents []*service.Service
+	for _, srv := range all {
+		if srv.Depends != nil && srv.Depends.Contains(name) {
+			dependents = append(dependents, srv)
+		}
+	}
+	return dependents, nil
 }
 
 const depGraphDefaultDepth = 4
 
 // ResolveDeps resolves the dependency graph for srv.
 // If srv has no dependencies, the dependency graph will be empty.
+// A *CycleError is returned if dependencies form a cycle,
+// and a *MissingDepError if a dependency does not exist.
 func (repo FS) ResolveDeps(srv *service.Service) (DepGraph, error) {
 	graph := NewDepGraph(depGraphDefaultDepth)
 	if srv.Depends == nil {
 		return graph, nil
 	}
-	return graph, repo.resolveDeps(&graph, 0, srv.Depends)
+	loaded := make(map[string]*service.Service)
+	err := repo.loadDeps(srv, nil, loaded)
+	if err != nil {
+		return graph, err
+	}
+	return graph, resolveDeps(&graph, 0, srv.Depends, loaded)
 }
 
 // DataDir returns the data directory path for a hypothetical service.
@@ -118,20 +226,44 @@ func (repo FS) LinkDir(name string) (string, error) {
 	}
 }
 
-func (repo FS) resolveDeps(graph *DepGraph, level int, deps *service.DepSet) error {
-	var err error
-	deps.ForEach(func(depName string) bool {
-		var srv *service.Service
-		srv, err = repo.Service(depName)
+// loadDeps loads all dependencies of srv, recursively, into loaded.
+// path is the chain of services that led to srv.
+func (repo FS) loadDeps(srv *service.Service, path []string, loaded map[string]*service.Service) error {
+	if srv.Depends == nil {
+		return nil
+	}
+	path = append(path, srv.Name)
+	deps := srv.Depends.Slice()
+	sort.Strings(deps)
+	for _, depName := range deps {
+		if i := slices.Index(path, depName); i >= 0 {
+			cycle := append(slices.Clone(path[i:]), depName)
+			return &CycleError{Path: cycle}
+		}
+		if _, ok := loaded[depName]; ok {
+			continue
+		}
+		dep, err := repo.Service(depName)
+		if err != nil {
+			if isMissing(err) {
+				return &MissingDepError{Service: srv.Name, Dependency: depName, Err: err}
+			}
+			return err
+		}
+		err = repo.loadDeps(dep, path, loaded)
 		if err != nil {
-			return false
+			return err
 		}
-		graph.Insert(level, srv)
+		loaded[depName] = dep
+	}
+	return nil
+}
+
+func resolveDeps(graph *DepGraph, level int, deps *service.DepSet, loaded map[string]*service.Service) error {
+	deps.ForEach(func(depName string) bool {
+		graph.Insert(level, loaded[depName])
 		return true
 	})
-	if err != nil {
-		return err
-	}
 
 	if level == graph.Depth() {
 		return nil
@@ -146,7 +278,14 @@ func (repo FS) resolveDeps(graph *DepGraph, level int, deps *service.DepSet) err
 		return true
 	})
 
-	return repo.resolveDeps(graph, level+1, &subdeps)
+	return resolveDeps(graph, level+1, &subdeps, loaded)
+}
+
+// isMissing reports whether err is due to a service not existing,
+// rather than a fragment it includes.
+func isMissing(err error) bool {
+	var incErr *IncludeError
+	return errors.Is(err, fs.ErrNotExist) && !errors.As(err, &incErr)
 }
 
 // OSFS circumvents the inability to check whether fs.FS
@@ -4,6 +4,7 @@
 package repo_test
 
 import (
+	"errors"
 	"io/fs"
 	"reflect"
 	"testing"
@@ -26,6 +27,112 @@ func TestService(t *testing.T) {
 	}
 }
 
+func TestServiceVariants(t *testing.T) {
+	fsys := fstest.MapFS{
+		"srv/service.yaml":        &fstest.MapFile{Data: []byte("packages: [generic]")},
+		"srv/service_fedora.yaml": &fstest.MapFile{Data: []byte("packages: [fedora]")},
+		"srv/service_linux.yaml":  &fstest.MapFile{Data: []byte("packages: [linux]")},
+	}
+	tests := []struct {
+		variants []string
+		expected []string
+	}{
+		{variants: []string{"fedora-40", "fedora", "linux"}, expected: []string{"generic", "linux", "fedora"}},
+		{variants: []string{"debian", "linux"}, expected: []string{"generic", "linux"}},
+		{variants: []string{"windows"}, expected: []string{"generic"}},
+		{variants: nil, expected: []string{"generic"}},
+	}
+	for _, test := range tests {
+		srv, err := repo.NewFSVariants(fsys, test.variants...).Service("srv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pkgs []string
+		for _, pkg := range srv.Packages {
+			pkgs = append(pkgs, pkg.Name)
+		}
+		if !reflect.DeepEqual(pkgs, test.expected) {
+			t.Fatalf("expected packages %v for candidates %v. Got %v", test.expected, test.variants, pkgs)
+		}
+	}
+}
+
+func TestServiceVariantOnly(t *testing.T) {
+	fsys := fstest.MapFS{"srv/service_linux.yaml": &fstest.MapFile{Data: []byte("packages: [linux]")}}
+	srv, err := repo.NewFSVariants(fsys, "linux").Service("srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.Packages) != 1 {
+		t.Fatalf("expected 1 package. Got %v", srv.Packages)
+	}
+	_, err = repo.NewFS(fsys).Service("srv")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected %v without variants. Got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestServiceInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"_common/base.yaml": &fstest.MapFile{Data: []byte("pkgmanager: [pm]\nvariables: {user: me, shell: sh}")},
+		"_common/gpg.yaml":  &fstest.MapFile{Data: []byte("include: [_common/base.yaml]\npackages: [gnupg]")},
+		"_common/zsh.yaml":  &fstest.MapFile{Data: []byte("include: [_common/base.yaml]\nvariables: {shell: zsh}")},
+		"srv/service.yaml":  &fstest.MapFile{Data: []byte("include: [_common/gpg.yaml, _common/zsh.yaml]\npackages: [vim]\nvariables: {user: you}")},
+	}
+	rep := repo.NewFS(fsys)
+	_, files, err := rep.ServiceNode("srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := []string{"_common/base.yaml", "_common/gpg.yaml", "_common/zsh.yaml", "srv/service.yaml"}
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Fatalf("expected files %v. Got %v", expectedFiles, files)
+	}
+	srv, err := rep.Service("srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(srv.PkgManager, []string{"pm"}) {
+		t.Fatalf("expected package manager [pm]. Got %v", srv.PkgManager)
+	}
+	if len(srv.Packages) != 2 || srv.Packages[0].Name != "gnupg" || srv.Packages[1].Name != "vim" {
+		t.Fatalf("expected packages [gnupg vim]. Got %v", srv.Packages)
+	}
+	if srv.Variables["user"].Value != "you" || srv.Variables["shell"].Value != "zsh" {
+		t.Fatalf("expected overridden variables. Got %v", srv.Variables)
+	}
+	all, err := rep.AllServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Name != "srv" {
+		t.Fatalf("expected only service srv. Got %v", all)
+	}
+}
+
+func TestServiceIncludeError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"_common/a.yaml":       &fstest.MapFile{Data: []byte("include: [_common/b.yaml]")},
+		"_common/b.yaml":       &fstest.MapFile{Data: []byte("include: [_common/a.yaml]")},
+		"cycle/service.yaml":   &fstest.MapFile{Data: []byte("include: [_common/a.yaml]")},
+		"missing/service.yaml": &fstest.MapFile{Data: []byte("include: [_common/ghost.yaml]")},
+	}
+	rep := repo.NewFS(fsys)
+	var incErr *repo.IncludeError
+	_, err := rep.Service("cycle")
+	if !errors.Is(err, repo.ErrIncludeCycle) || !errors.As(err, &incErr) || incErr.File != "_common/b.yaml" {
+		t.Fatalf("expected an include cycle error from _common/b.yaml. Got %v", err)
+	}
+	_, err = rep.Service("missing")
+	if !errors.Is(err, fs.ErrNotExist) || !errors.As(err, &incErr) || incErr.File != "missing/service.yaml" {
+		t.Fatalf("expected a missing fragment error from missing/service.yaml. Got %v", err)
+	}
+	_, err = rep.AllServices()
+	if !errors.As(err, &incErr) {
+		t.Fatalf("expected an include error from all services. Got %v", err)
+	}
+}
+
 func TestAllServices(t *testing.T) {
 	fs := fstest.MapFS{
 		"srv1/service.yaml": &fstest.MapFile{},
@@ -77,3 +184,94 @@ func TestResolveDeps(t *testing.T) {
 		t.Fatalf("expected %v. Got %v", expected, obtained)
 	}
 }
+
+func TestDependents(t *testing.T) {
+	fs := fstest.MapFS{
+		"srv1/service.yaml": &fstest.MapFile{Data: []byte(`depends: ["base"]`)},
+		"srv2/service.yaml": &fstest.MapFile{Data: []byte(`depends: ["other"]`)},
+		"base/service.yaml": &fstest.MapFile{},
+	}
+	rep := repo.NewFS(fs)
+	obtained, err := rep.Dependents("base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obtained) != 1 || obtained[0].Name != "srv1" {
+		t.Fatalf("expected dependents [srv1]. Got %v", obtained)
+	}
+}
+
+func TestResolveDepsCycle(t *testing.T) {
+	fs := fstest.MapFS{
+		"a/service.yaml": &fstest.MapFile{Data: []byte(`depends: ["b"]`)},
+		"b/service.yaml": &fstest.MapFile{Data: []byte(`depends: ["c"]`)},
+		"c/service.yaml": &fstest.MapFile{Data: []byte(`depends: ["a"]`)},
+	}
+	rep := repo.NewFS(fs)
+	srv, err := rep.Service("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rep.ResolveDeps(srv)
+	var cycle *repo.CycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("expected a cycle error. Got %v", err)
+	}
+	expected := []string{"a", "b", "c", "a"}
+	if !reflect.DeepEqual(cycle.Path, expected) {
+		t.Fatalf("expected cycle %v. Got %v", expected, cycle.Path)
+	}
+	if !errors.Is(err, repo.ErrDepCycle) {
+		t.Fatalf("expected error %v. Got %v", repo.ErrDepCycle, err)
+	}
+}
+
+func TestResolveDepsSelfCycle(t *testing.T) {
+	fs := fstest.MapFS{
+		"a/service.yaml": &fstest.MapFile{Data: []byte(`depends: ["a"]`)},
+	}
+	rep := repo.NewFS(fs)
+	srv, _ := rep.Service("a")
+	_, err := rep.ResolveDeps(srv)
+	if !errors.Is(err, repo.ErrDepCycle) {
+		t.Fatalf("expected error %v. Got %v", repo.ErrDepCycle, err)
+	}
+}
+
+func TestResolveDepsMissing(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/service.yaml": &fstest.MapFile{Data: []byte(`depends: ["b"]`)},
+		"b/service.yaml": &fstest.MapFile{Data: []byte(`depends: ["ghost"]`)},
+	}
+	rep := repo.NewFS(fsys)
+	srv, _ := rep.Service("a")
+	_, err := rep.ResolveDeps(srv)
+	var missing *repo.MissingDepError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected a missing dependency error. Got %v", err)
+	}
+	if missing.Service != "b" || missing.Dependency != "ghost" {
+		t.Fatalf("expected b to miss ghost. Got %s missing %s", missing.Service, missing.Dependency)
+	}
+	if !errors.Is(err, repo.ErrNoService) || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected error to wrap %v and %v. Got %v", repo.ErrNoService, fs.ErrNotExist, err)
+	}
+}
+
+func TestResolveDepsDiamond(t *testing.T) {
+	fs := fstest.MapFS{
+		"b/service.yaml":    &fstest.MapFile{Data: []byte(`depends: ["base"]`)},
+		"c/service.yaml":    &fstest.MapFile{Data: []byte(`depends: ["base"]`)},
+		"base/service.yaml": &fstest.MapFile{},
+	}
+	deps := service.NewDepSetFrom([]string{"b", "c"})
+	srv := &service.Service{Name: "a", Depends: &deps}
+	rep := repo.NewFS(fs)
+	graph, err := rep.ResolveDeps(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if graph.Depth() != 2 {
+		t.Fatalf("expected depth 2. Got %d", graph.Depth())
+	}
+}
@@ -0,0 +1,258 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/livingsilver94/backee/service"
+)
+
+// Graph is the dependency graph of a set of services, as nodes and edges.
+// Unlike DepGraph, it is meant for display, so it tolerates
+// cycles and missing dependencies.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a service in a Graph.
+type GraphNode struct {
+	Name string `json:"name"`
+	// Level is the installation order: services on level 0 have no dependencies
+	// and are installed first, then level 1 and so on.
+	// Edges that form a cycle are not taken into account.
+	Level int `json:"level"`
+	// Missing is true if the service was declared as a dependency but does not exist.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// GraphEdge is a dependency of the service From on the service To.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Cycle is true if the edge is part of a dependency cycle.
+	Cycle bool `json:"cycle,omitempty"`
+}
+
+// Graph returns the dependency graph of roots and all their dependencies.
+func (repo FS) Graph(roots []*service.Service) (Graph, error) {
+	loaded := make(map[string]*service.Service, len(roots))
+	missing := make(map[string]bool)
+	queue := make([]*service.Service, 0, len(roots))
+	for _, root := range roots {
+		if _, ok := loaded[root.Name]; !ok {
+			loaded[root.Name] = root
+			queue = append(queue, root)
+		}
+	}
+	adjacency := make(map[string][]string)
+	for len(queue) != 0 {
+		srv := queue[0]
+		queue = queue[1:]
+		if srv.Depends == nil {
+			continue
+		}
+		deps := srv.Depends.Slice()
+		sort.Strings(deps)
+		adjacency[srv.Name] = deps
+		for _, depName := range deps {
+			if _, ok := loaded[depName]; ok || missing[depName] {
+				continue
+			}
+			dep, err := repo.Service(depName)
+			if err != nil {
+				if !isMissing(err) {
+					return Graph{}, err
+				}
+				missing[depName] = true
+				continue
+			}
+			loaded[depName] = dep
+			queue = append(queue, dep)
+		}
+	}
+
+	names := make([]string, 0, len(loaded)+len(missing))
+	for name := range loaded {
+		names = append(names, name)
+	}
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	component := stronglyConnected(names, adjacency)
+	inCycle := func(from, to string) bool {
+		if from == to {
+			return true
+		}
+		return component[from] == component[to]
+	}
+
+	graph := Graph{
+		Nodes: make([]GraphNode, 0, len(names)),
+		Edges: make([]GraphEdge, 0, len(adjacency)),
+	}
+	for _, from := range names {
+		for _, to := range adjacency[from] {
+			graph.Edges = append(graph.Edges, GraphEdge{From: from, To: to, Cycle: inCycle(from, to)})
+		}
+	}
+	levels := make(map[string]int, len(names))
+	var level func(name string) int
+	level = func(name string) int {
+		if lvl, ok := levels[name]; ok {
+			return lvl
+		}
+		lvl := 0
+		for _, dep := range adjacency[name] {
+			if !inCycle(name, dep) {
+				lvl = max(lvl, level(dep)+1)
+			}
+		}
+		levels[name] = lvl
+		return lvl
+	}
+	for _, name := range names {
+		graph.Nodes = append(graph.Nodes, GraphNode{Name: name, Level: level(name), Missing: missing[name]})
+	}
+	sort.SliceStable(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].Level < graph.Nodes[j].Level })
+	return graph, nil
+}
+
+// stronglyConnected returns the strongly connected component
+// index of each node, computed with Tarjan's algorithm.
+func stronglyConnected(nodes []string, adjacency map[string][]string) map[string]int {
+	var (
+		index     = 0
+		indices   = make(map[string]int, len(nodes))
+		lowlink   = make(map[string]int, len(nodes))
+		onStack   = make(map[string]bool, len(nodes))
+		stack     []string
+		component = make(map[string]int, len(nodes))
+		count     = 0
+	)
+	var connect func(node string)
+	connect = func(node string) {
+		indices[node] = index
+		lowlink[node] = index
+		index++
+		stack = append(stack, node)
+		onStack[node] = true
+		for _, next := range adjacency[node] {
+			if _, visited := indices[next]; !visited {
+				connect(next)
+				lowlink[node] = min(lowlink[node], lowlink[next])
+			} else if onStack[next] {
+				lowlink[node] = min(lowlink[node], indices[next])
+			}
+		}
+		if lowlink[node] != indices[node] {
+			return
+		}
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component[top] = count
+			if top == node {
+				break
+			}
+		}
+		count++
+	}
+	for _, node := range nodes {
+		if _, visited := indices[node]; !visited {
+			connect(node)
+		}
+	}
+	return component
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language.
+// Services on the same level are ranked together and cycles are colored in red.
+func (g Graph) WriteDOT(w io.Writer) error {
+	b := &strings.Builder{}
+	b.WriteString("digraph backee {\n\trankdir=BT;\n\tnode [shape=box];\n")
+	for _, level := range g.levels() {
+		fmt.Fprintf(b, "\tsubgraph level%d {\n\t\trank=same;\n", level[0].Level)
+		for _, node := range level {
+			fmt.Fprintf(b, "\t\t%s [label=%s", strconv.Quote(node.Name), strconv.Quote(fmt.Sprintf("%s\nlevel %d", node.Name, node.Level)))
+			if node.Missing {
+				b.WriteString(", style=dashed")
+			}
+			b.WriteString("];\n")
+		}
+		b.WriteString("\t}\n")
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(b, "\t%s -> %s", strconv.Quote(edge.From), strconv.Quote(edge.To))
+		if edge.Cycle {
+			b.WriteString(" [color=red, penwidth=2]")
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart.
+// Cycles are colored in red.
+func (g Graph) WriteMermaid(w io.Writer) error {
+	ids := make(map[string]string, len(g.Nodes))
+	b := &strings.Builder{}
+	b.WriteString("flowchart BT\n")
+	for _, level := range g.levels() {
+		fmt.Fprintf(b, "\tsubgraph level%d [\"level %d\"]\n", level[0].Level, level[0].Level)
+		for _, node := range level {
+			id := "n" + strconv.Itoa(len(ids))
+			ids[node.Name] = id
+			label := strings.ReplaceAll(node.Name, `"`, "#quot;")
+			if node.Missing {
+				fmt.Fprintf(b, "\t\t%s[/\"%s (missing)\"/]\n", id, label)
+			} else {
+				fmt.Fprintf(b, "\t\t%s[\"%s\"]\n", id, label)
+			}
+		}
+		b.WriteString("\tend\n")
+	}
+	var cycles []string
+	for i, edge := range g.Edges {
+		fmt.Fprintf(b, "\t%s --> %s\n", ids[edge.From], ids[edge.To])
+		if edge.Cycle {
+			cycles = append(cycles, strconv.Itoa(i))
+		}
+	}
+	if len(cycles) != 0 {
+		fmt.Fprintf(b, "\tlinkStyle %s stroke:red,stroke-width:2px\n", strings.Join(cycles, ","))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the graph as a JSON document.
+func (g Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(g)
+}
+
+// levels groups nodes by level. Nodes must be sorted by level.
+func (g Graph) levels() [][]GraphNode {
+	var levels [][]GraphNode
+	for i, node := range g.Nodes {
+		if i == 0 || node.Level != g.Nodes[i-1].Level {
+			levels = append(levels, nil)
+		}
+		levels[len(levels)-1] = append(levels[len(levels)-1], node)
+	}
+	return levels
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/livingsilver94/backee/repo"
+	"github.com/livingsilver94/backee/service"
+)
+
+func TestGraphLevels(t *testing.T) {
+	fs := fstest.MapFS{
+		"app/service.yaml":  &fstest.MapFile{Data: []byte(`depends: ["lib", "base"]`)},
+		"lib/service.yaml":  &fstest.MapFile{Data: []byte(`depends: ["base"]`)},
+		"base/service.yaml": &fstest.MapFile{},
+	}
+	rep := repo.NewFS(fs)
+	app, _ := rep.Service("app")
+	graph, err := rep.Graph([]*service.Service{app})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []repo.GraphNode{
+		{Name: "base", Level: 0},
+		{Name: "lib", Level: 1},
+		{Name: "app", Level: 2},
+	}
+	if !reflect.DeepEqual(graph.Nodes, expected) {
+		t.Fatalf("expected nodes %v. Got %v", expected, graph.Nodes)
+	}
+	if len(graph.Edges) != 3 {
+		t.Fatalf("expected 3 edges. Got %v", graph.Edges)
+	}
+}
+
+func TestGraphCycle(t *testing.T) {
+	fs := fstest.MapFS{
+		"a/service.yaml": &fstest.MapFile{Data: []byte(`depends: ["b", "ghost"]`)},
+		"b/service.yaml": &fstest.MapFile{Data: []byte(`depends: ["a", "c"]`)},
+		"c/service.yaml": &fstest.MapFile{},
+	}
+	rep := repo.NewFS(fs)
+	a, _ := rep.Service("a")
+	graph, err := rep.Graph([]*service.Service{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []repo.GraphEdge{
+		{From: "a", To: "b", Cycle: true},
+		{From: "a", To: "ghost"},
+		{From: "b", To: "a", Cycle: true},
+		{From: "b", To: "c"},
+	}
+	if !reflect.DeepEqual(graph.Edges, expected) {
+		t.Fatalf("expected edges %v. Got %v", expected, graph.Edges)
+	}
+	for _, node := range graph.Nodes {
+		if node.Missing != (node.Name == "ghost") {
+			t.Fatalf("unexpected missing status for %v", node)
+		}
+	}
+
+	dot := &strings.Builder{}
+	err = graph.WriteDOT(dot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dot.String(), `"b" -> "a" [color=red, penwidth=2];`) {
+		t.Fatalf("cycle is not highlighted in DOT output:\n%s", dot)
+	}
+	mermaid := &strings.Builder{}
+	err = graph.WriteMermaid(mermaid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(mermaid.String(), "linkStyle 0,2 stroke:red") {
+		t.Fatalf("cycle is not highlighted in Mermaid output:\n%s", mermaid)
+	}
+}
+
+func TestGraphMissingInclude(t *testing.T) {
+	fs := fstest.MapFS{
+		"a/service.yaml": &fstest.MapFile{Data: []byte(`depends: ["b"]`)},
+		"b/service.yaml": &fstest.MapFile{Data: []byte(`include: [_common/missing.yaml]`)},
+	}
+	rep := repo.NewFS(fs)
+	a, _ := rep.Service("a")
+	_, err := rep.Graph([]*service.Service{a})
+	var incErr *repo.IncludeError
+	if !errors.As(err, &incErr) {
+		t.Fatalf("expected %T. Got %v", incErr, err)
+	}
+}
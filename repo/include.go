@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/livingsilver94/backee/service"
+	"gopkg.in/yaml.v3"
+)
+
+// IncludeKey is the key of a service file that lists the fragments it includes.
+// Fragment paths are relative to the repository's root.
+const IncludeKey = "include"
+
+// ErrIncludeCycle is returned when fragments include each other in a loop.
+var ErrIncludeCycle = errors.New("include cycle")
+
+// IncludeError reports a fragment that could not be included.
+type IncludeError struct {
+	// File is the path of the including file.
+	File string
+	// Fragment is the path of the included fragment.
+	Fragment string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *IncludeError) Error() string {
+	return fmt.Sprintf("%s: including %s: %v", e.File, e.Fragment, e.Err)
+}
+
+func (e *IncludeError) Unwrap() error {
+	return e.Err
+}
+
+// JSONSchema returns a JSON Schema of service files, as in service.JSONSchema,
+// that also covers IncludeKey.
+func JSONSchema() ([]byte, error) {
+	return service.JSONSchema(map[string]any{
+		IncludeKey: map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+	})
+}
+
+// loadLayer parses the file at fpath and merges it over the fragments it includes.
+// stack is the chain of files that included fpath. Paths of the files merged
+// are appended to files, and fragments already there are not merged again.
+func (repo FS) loadLayer(fpath string, stack []string, files *[]string) (*yaml.Node, error) {
+	data, err := fs.ReadFile(repo.baseFS, fpath)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, service.Diagnose(err).InFile(fpath)
+	}
+	includes, err := popIncludes(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fpath, err)
+	}
+	if diags := service.Check(&doc); len(diags) != 0 {
+		return nil, diags.InFile(fpath)
+	}
+
+	stack = append(stack, fpath)
+	var merged *yaml.Node
+	for _, frag := range includes {
+		frag = path.Clean(frag)
+		if i := slices.Index(stack, frag); i >= 0 {
+			cycle := append(slices.Clone(stack[i:]), frag)
+			err := fmt.Errorf("%w: %s", ErrIncludeCycle, strings.Join(cycle, " → "))
+			return nil, &IncludeError{File: fpath, Fragment: frag, Err: err}
+		}
+		if slices.Contains(*files, frag) {
+			continue
+		}
+		_, err := fs.Stat(repo.baseFS, frag)
+		if err != nil {
+			return nil, &IncludeError{File: fpath, Fragment: frag, Err: err}
+		}
+		node, err := repo.loadLayer(frag, stack, files)
+		if err != nil {
+			return nil, err
+		}
+		merged = service.MergeYAML(merged, node)
+	}
+	*files = append(*files, fpath)
+	if doc.Kind == 0 {
+		return merged, nil
+	}
+	return service.MergeYAML(merged, &doc), nil
+}
+
+// popIncludes removes the IncludeKey entry from doc, and returns its paths.
+func popIncludes(doc *yaml.Node) ([]string, error) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i < len(root.Content)-1; i += 2 {
+		if root.Content[i].Value != IncludeKey {
+			continue
+		}
+		val := root.Content[i+1]
+		root.Content = slices.Delete(root.Content, i, i+2)
+		var includes []string
+		err := val.Decode(&includes)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a list of paths: %w", IncludeKey, err)
+		}
+		return includes, nil
+	}
+	return nil, nil
+}
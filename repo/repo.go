@@ -3,7 +3,13 @@
 
 package repo
 
-import "github.com/livingsilver94/backee/service"
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/livingsilver94/backee/service"
+)
 
 // Repo is capable of fetching services from a source.
 type Repo interface {
@@ -14,3 +20,39 @@ type Repo interface {
 	// ResolveDeps creates the dependency tree of a service.
 	ResolveDeps(srv *service.Service) (DepGraph, error)
 }
+
+// ErrDepCycle is returned when services depend on each other in a loop.
+var ErrDepCycle = errors.New("dependency cycle")
+
+// CycleError reports a dependency cycle.
+type CycleError struct {
+	// Path is the chain of service names forming the cycle.
+	// The first and the last names are the same.
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrDepCycle, strings.Join(e.Path, " → "))
+}
+
+func (e *CycleError) Unwrap() error {
+	return ErrDepCycle
+}
+
+// MissingDepError reports a dependency that could not be found.
+type MissingDepError struct {
+	// Service is the name of the service declaring the dependency.
+	Service string
+	// Dependency is the name of the missing service.
+	Dependency string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *MissingDepError) Error() string {
+	return fmt.Sprintf("%s depends on %s: %s", e.Service, e.Dependency, ErrNoService)
+}
+
+func (e *MissingDepError) Unwrap() []error {
+	return []error{ErrNoService, e.Err}
+}
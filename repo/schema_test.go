@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/livingsilver94/backee/repo"
+	_ "github.com/livingsilver94/backee/repo/solver"
+)
+
+// TestJSONSchemaPublished keeps the published schema in sync with the Go types.
+func TestJSONSchemaPublished(t *testing.T) {
+	published, err := os.ReadFile("../service.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := repo.JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	published = bytes.ReplaceAll(bytes.TrimSpace(published), []byte("\r\n"), []byte("\n"))
+	if !bytes.Equal(published, schema) {
+		t.Fatal("service.schema.json is outdated: run `task schema`")
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/livingsilver94/backee/service"
+	"gopkg.in/yaml.v3"
+)
+
+// SecretsFilename is the name of the file, in the directory of a service,
+// that maps names of variables to values encrypted with age, in the armored format.
+// Names are not encrypted, so that the file can be reviewed and validated.
+const SecretsFilename = "secrets.enc.yaml"
+
+// Secrets returns the encrypted variables of the service named name,
+// read from its SecretsFilename. They are empty if the file doesn't exist.
+func (repo FS) Secrets(name string) (map[string]string, error) {
+	fpath := name + "/" + SecretsFilename
+	data, err := fs.ReadFile(repo.baseFS, fpath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var secrets map[string]string
+	err = yaml.Unmarshal(data, &secrets)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fpath, err)
+	}
+	return secrets, nil
+}
+
+// addSecrets adds the encrypted variables of srv to its variables.
+// Variables defined by service files take precedence.
+func (repo FS) addSecrets(srv *service.Service) error {
+	secrets, err := repo.Secrets(srv.Name)
+	if err != nil {
+		return err
+	}
+	if len(secrets) != 0 && srv.Variables == nil {
+		srv.Variables = make(map[string]service.VarValue, len(secrets))
+	}
+	for name, val := range secrets {
+		if _, ok := srv.Variables[name]; ok {
+			continue
+		}
+		srv.Variables[name] = service.VarValue{Kind: service.Encrypted, Value: val}
+	}
+	return nil
+}
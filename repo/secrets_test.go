@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/livingsilver94/backee/repo"
+	"github.com/livingsilver94/backee/service"
+)
+
+func TestServiceSecrets(t *testing.T) {
+	const secrets = `
+token: |
+  -----BEGIN AGE ENCRYPTED FILE-----
+  token
+  -----END AGE ENCRYPTED FILE-----
+user: encrypted user`
+	fsys := fstest.MapFS{
+		"srv/service.yaml":            &fstest.MapFile{Data: []byte("variables: {user: admin}")},
+		"srv/" + repo.SecretsFilename: &fstest.MapFile{Data: []byte(secrets)},
+	}
+	srv, err := repo.NewFS(fsys).Service("srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]service.VarValue{
+		"token": {Kind: service.Encrypted, Value: "-----BEGIN AGE ENCRYPTED FILE-----\ntoken\n-----END AGE ENCRYPTED FILE-----\n"},
+		"user":  {Kind: service.ClearText, Value: "admin"},
+	}
+	for name, val := range expected {
+		if srv.Variables[name] != val {
+			t.Fatalf("expected variable %s to be %v. Got %v", name, val, srv.Variables[name])
+		}
+	}
+}
+
+func TestServiceSecretsInvalid(t *testing.T) {
+	fsys := fstest.MapFS{
+		"srv/service.yaml":            &fstest.MapFile{},
+		"srv/" + repo.SecretsFilename: &fstest.MapFile{Data: []byte("token: [not, a, string]")},
+	}
+	_, err := repo.NewFS(fsys).Service("srv")
+	if err == nil {
+		t.Fatal("expected an error for a secret that is not a string")
+	}
+}
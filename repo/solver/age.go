@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package solver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// ErrNoIdentity is returned when decrypting without an age identity.
+var ErrNoIdentity = errors.New("no age identity to decrypt secrets")
+
+// Age decrypts variables of kind service.Encrypted.
+type Age struct {
+	identities []age.Identity
+	prompt     Prompt
+
+	once       sync.Once
+	passphrase age.Identity
+	promptErr  error
+}
+
+// NewAge returns an Age decrypting with identities.
+func NewAge(identities ...age.Identity) *Age {
+	return &Age{identities: identities}
+}
+
+// WithPrompt makes a ask for a passphrase with prompt, once, when it has
+// no identities and decrypts data encrypted with a passphrase. It returns a.
+func (a *Age) WithPrompt(prompt Prompt) *Age {
+	a.prompt = prompt
+	return a
+}
+
+// Value decrypts armored, which is encrypted with age in the armored format.
+func (a *Age) Value(armored string) (string, error) {
+	data, err := a.Decrypt(strings.NewReader(armored))
+	return string(data), err
+}
+
+// Decrypt decrypts the age file read from r, either armored or binary.
+func (a *Age) Decrypt(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	open := func() io.Reader {
+		if bytes.HasPrefix(data, []byte(armor.Header)) {
+			return armor.NewReader(bytes.NewReader(data))
+		}
+		return bytes.NewReader(data)
+	}
+	ids := a.identities
+	if len(ids) == 0 && a.prompt != nil && isScrypt(open()) {
+		a.once.Do(func() {
+			var pass string
+			pass, a.promptErr = a.prompt("Passphrase of age secrets")
+			if a.promptErr == nil {
+				a.passphrase, a.promptErr = age.NewScryptIdentity(pass)
+			}
+		})
+		if a.promptErr != nil {
+			return nil, a.promptErr
+		}
+		ids = []age.Identity{a.passphrase}
+	}
+	if len(ids) == 0 {
+		return nil, ErrNoIdentity
+	}
+	dec, err := age.Decrypt(open(), ids...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(dec)
+}
+
+// isScrypt returns whether the age file read from r is encrypted with a passphrase.
+func isScrypt(r io.Reader) bool {
+	lines := bufio.NewScanner(r)
+	if !lines.Scan() || lines.Text() != "age-encryption.org/v1" {
+		return false
+	}
+	return lines.Scan() && strings.HasPrefix(lines.Text(), "-> scrypt ")
+}
+
+// Encrypt encrypts plaintext for recipients with age, in the armored format.
+func Encrypt(plaintext string, recipients ...age.Recipient) (string, error) {
+	var buf strings.Builder
+	arm := armor.NewWriter(&buf)
+	enc, err := age.Encrypt(arm, recipients...)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.WriteString(enc, plaintext)
+	if err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	if err := arm.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
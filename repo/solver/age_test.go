@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package solver_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/livingsilver94/backee/repo/solver"
+)
+
+func TestAge(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const secret = "s3cret\nwith two lines"
+	enc, err := solver.Encrypt(secret, id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enc, "-----BEGIN AGE ENCRYPTED FILE-----") {
+		t.Fatalf("expected an armored file. Got %q", enc)
+	}
+	val, err := solver.NewAge(id).Value(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != secret {
+		t.Fatalf("expected value %q. Got %q", secret, val)
+	}
+
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var noMatch *age.NoIdentityMatchError
+	if _, err := solver.NewAge(other).Value(enc); !errors.As(err, &noMatch) {
+		t.Fatalf("expected %T. Got %v", noMatch, err)
+	}
+	if _, err := solver.NewAge().Value(enc); !errors.Is(err, solver.ErrNoIdentity) {
+		t.Fatalf("expected %v. Got %v", solver.ErrNoIdentity, err)
+	}
+}
+
+func TestAgePrompt(t *testing.T) {
+	rcpt, err := age.NewScryptRecipient("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcpt.SetWorkFactor(10)
+	const secret = "s3cret"
+	enc, err := solver.Encrypt(secret, rcpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prompts int
+	a := solver.NewAge().WithPrompt(func(string) (string, error) {
+		prompts++
+		return "passphrase", nil
+	})
+	for i := 0; i < 2; i++ {
+		val, err := a.Value(enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != secret {
+			t.Fatalf("expected value %q. Got %q", secret, val)
+		}
+	}
+	if prompts != 1 {
+		t.Fatalf("expected 1 prompt. Got %d", prompts)
+	}
+
+	// Files encrypted for a public key need an identity, not a passphrase.
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err = solver.Encrypt(secret, id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Value(enc); !errors.Is(err, solver.ErrNoIdentity) {
+		t.Fatalf("expected %v. Got %v", solver.ErrNoIdentity, err)
+	}
+}
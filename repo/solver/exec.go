@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package solver
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/livingsilver94/backee/service"
+)
+
+// ExecKind is the kind of variables solved by Exec.
+const ExecKind service.VarKind = "exec"
+
+// ExecPlaceholder is replaced with the secret to read
+// in the arguments of Exec's commands.
+const ExecPlaceholder = "{}"
+
+func init() {
+	service.RegisterVarKind(ExecKind)
+}
+
+// Exec reads secrets by running the command of an external secret manager,
+// such as the Bitwarden or 1Password CLI.
+type Exec struct {
+	backends map[string][]string
+}
+
+// NewExec returns an Exec running the commands in backends,
+// indexed by the name of their secret manager. The first element
+// of a command is the program to run, and the others its arguments.
+func NewExec(backends map[string][]string) *Exec {
+	return &Exec{
+		backends: backends,
+	}
+}
+
+// Value runs the command of a backend and returns its standard output,
+// with leading and trailing white space removed. key is in the form backend:secret,
+// such as "bw:github.com", and secret replaces ExecPlaceholder in the command's arguments.
+func (e *Exec) Value(key string) (string, error) {
+	name, secret, ok := strings.Cut(key, AttrSep)
+	if !ok {
+		return "", fmt.Errorf("exec variable %q is not in the form backend%ssecret", key, AttrSep)
+	}
+	command, ok := e.backends[name]
+	if !ok || len(command) == 0 {
+		return "", fmt.Errorf("unknown exec backend %q", name)
+	}
+	args := make([]string, len(command)-1)
+	for i, arg := range command[1:] {
+		args[i] = strings.ReplaceAll(arg, ExecPlaceholder, secret)
+	}
+	out, err := exec.Command(command[0], args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if stderr := strings.TrimSpace(string(exitErr.Stderr)); stderr != "" {
+				err = errors.New(stderr)
+			}
+		}
+		return "", fmt.Errorf("exec backend %s reading %q: %w", name, secret, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package solver_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/livingsilver94/backee/repo/solver"
+)
+
+func TestExec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not installed")
+	}
+	e := solver.NewExec(map[string][]string{
+		"echo":   {"sh", "-c", `echo "  secret of $0  "`, "{}"},
+		"broken": {"sh", "-c", "echo 'vault is locked' >&2; exit 1"},
+	})
+	val, err := e.Value("echo:a:b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "secret of a:b" {
+		t.Fatalf("expected value %q. Got %q", "secret of a:b", val)
+	}
+
+	_, err = e.Value("broken:x")
+	if err == nil || !strings.Contains(err.Error(), "vault is locked") {
+		t.Fatalf("expected an error with the backend's stderr. Got %v", err)
+	}
+	for _, key := range []string{"missing:x", "nobackend"} {
+		if _, err := e.Value(key); err == nil {
+			t.Fatalf("expected an error for %q", key)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package kdbx
+
+import (
+	"encoding/binary"
+	"hash"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Argon2 is implemented here because golang.org/x/crypto/argon2
+// does not provide Argon2d, the default of KeePassXC. See RFC 9106.
+
+// argon2Mode is the Argon2 variant.
+type argon2Mode uint32
+
+const (
+	argon2d  argon2Mode = 0
+	argon2id argon2Mode = 2
+)
+
+const (
+	argon2Version    = 0x13
+	argon2SyncPoints = 4
+	argon2BlockWords = 128
+)
+
+type argon2Block [argon2BlockWords]uint64
+
+// argon2Key derives a key of keyLen bytes from password and salt.
+// memory is in KiB. secret and data are optional.
+func argon2Key(mode argon2Mode, password, salt, secret, data []byte, time, memory, threads, keyLen uint32) []byte {
+	h0 := argon2InitHash(mode, password, salt, secret, data, time, memory, threads, keyLen)
+	memory = memory / (argon2SyncPoints * threads) * (argon2SyncPoints * threads)
+	if memory < 2*argon2SyncPoints*threads {
+		memory = 2 * argon2SyncPoints * threads
+	}
+	blocks := argon2InitBlocks(&h0, memory, threads)
+	argon2Fill(mode, blocks, time, memory, threads)
+	return argon2Extract(blocks, memory, threads, keyLen)
+}
+
+func argon2InitHash(mode argon2Mode, password, salt, secret, data []byte, time, memory, threads, keyLen uint32) [blake2b.Size + 8]byte {
+	var h0 [blake2b.Size + 8]byte
+	b2, _ := blake2b.New512(nil)
+	writeUint32 := func(v uint32) {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], v)
+		b2.Write(buf[:])
+	}
+	for _, v := range []uint32{threads, keyLen, memory, time, argon2Version, uint32(mode)} {
+		writeUint32(v)
+	}
+	for _, field := range [][]byte{password, salt, secret, data} {
+		writeUint32(uint32(len(field)))
+		b2.Write(field)
+	}
+	b2.Sum(h0[:0])
+	return h0
+}
+
+func argon2InitBlocks(h0 *[blake2b.Size + 8]byte, memory, threads uint32) []argon2Block {
+	var buf [1024]byte
+	blocks := make([]argon2Block, memory)
+	for lane := uint32(0); lane < threads; lane++ {
+		j := lane * (memory / threads)
+		binary.LittleEndian.PutUint32(h0[blake2b.Size+4:], lane)
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(h0[blake2b.Size:], i)
+			blake2bLong(buf[:], h0[:])
+			for k := range blocks[j+i] {
+				blocks[j+i][k] = binary.LittleEndian.Uint64(buf[k*8:])
+			}
+		}
+	}
+	return blocks
+}
+
+func argon2Fill(mode argon2Mode, blocks []argon2Block, time, memory, threads uint32) {
+	lanes := memory / threads
+	segments := lanes / argon2SyncPoints
+
+	processSegment := func(pass, slice, lane uint32) {
+		var addresses, in, zero argon2Block
+		independent := mode == argon2id && pass == 0 && slice < argon2SyncPoints/2
+		if independent {
+			in[0] = uint64(pass)
+			in[1] = uint64(lane)
+			in[2] = uint64(slice)
+			in[3] = uint64(memory)
+			in[4] = uint64(time)
+			in[5] = uint64(mode)
+		}
+		index := uint32(0)
+		if pass == 0 && slice == 0 {
+			// The first two blocks are already initialized.
+			index = 2
+			if independent {
+				in[6]++
+				argon2Compress(&addresses, &in, &zero, false)
+				argon2Compress(&addresses, &addresses, &zero, false)
+			}
+		}
+		offset := lane*lanes + slice*segments + index
+		for index < segments {
+			prev := offset - 1
+			if index == 0 && slice == 0 {
+				prev += lanes
+			}
+			var random uint64
+			if independent {
+				if index%argon2BlockWords == 0 {
+					in[6]++
+					argon2Compress(&addresses, &in, &zero, false)
+					argon2Compress(&addresses, &addresses, &zero, false)
+				}
+				random = addresses[index%argon2BlockWords]
+			} else {
+				random = blocks[prev][0]
+			}
+			ref := argon2RefIndex(random, lanes, segments, threads, pass, slice, lane, index)
+			argon2Compress(&blocks[offset], &blocks[prev], &blocks[ref], true)
+			index, offset = index+1, offset+1
+		}
+	}
+
+	for pass := uint32(0); pass < time; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			var wg sync.WaitGroup
+			for lane := uint32(0); lane < threads; lane++ {
+				wg.Add(1)
+				go func(lane uint32) {
+					defer wg.Done()
+					processSegment(pass, slice, lane)
+				}(lane)
+			}
+			wg.Wait()
+		}
+	}
+}
+
+// argon2RefIndex returns the index of the block that the block
+// at index of a segment is computed from.
+func argon2RefIndex(random uint64, lanes, segments, threads, pass, slice, lane, index uint32) uint32 {
+	refLane := uint32(random>>32) % threads
+	if pass == 0 && slice == 0 {
+		refLane = lane
+	}
+	area, start := 3*segments, ((slice+1)%argon2SyncPoints)*segments
+	if lane == refLane {
+		area += index
+	}
+	if pass == 0 {
+		area, start = slice*segments, 0
+		if slice == 0 || lane == refLane {
+			area += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		area--
+	}
+	rel := random & 0xFFFFFFFF
+	rel = (rel * rel) >> 32
+	rel = (rel * uint64(area)) >> 32
+	return refLane*lanes + uint32((uint64(start)+uint64(area)-(rel+1))%uint64(lanes))
+}
+
+// argon2Compress computes the compression function G of in1 and in2 into out.
+// If xor is true, the result is XORed with the content of out.
+func argon2Compress(out, in1, in2 *argon2Block, xor bool) {
+	var t argon2Block
+	for i := range t {
+		t[i] = in1[i] ^ in2[i]
+	}
+	r := t
+	for i := 0; i < argon2BlockWords; i += 16 {
+		blamkaRound(
+			&t[i+0], &t[i+1], &t[i+2], &t[i+3], &t[i+4], &t[i+5], &t[i+6], &t[i+7],
+			&t[i+8], &t[i+9], &t[i+10], &t[i+11], &t[i+12], &t[i+13], &t[i+14], &t[i+15],
+		)
+	}
+	for i := 0; i < argon2BlockWords/8; i += 2 {
+		blamkaRound(
+			&t[i], &t[i+1], &t[16+i], &t[16+i+1], &t[32+i], &t[32+i+1], &t[48+i], &t[48+i+1],
+			&t[64+i], &t[64+i+1], &t[80+i], &t[80+i+1], &t[96+i], &t[96+i+1], &t[112+i], &t[112+i+1],
+		)
+	}
+	for i := range t {
+		if xor {
+			out[i] ^= r[i] ^ t[i]
+		} else {
+			out[i] = r[i] ^ t[i]
+		}
+	}
+}
+
+// blamkaRound is the BLAKE2b round function, with multiplications.
+func blamkaRound(v0, v1, v2, v3, v4, v5, v6, v7, v8, v9, v10, v11, v12, v13, v14, v15 *uint64) {
+	blamkaG(v0, v4, v8, v12)
+	blamkaG(v1, v5, v9, v13)
+	blamkaG(v2, v6, v10, v14)
+	blamkaG(v3, v7, v11, v15)
+	blamkaG(v0, v5, v10, v15)
+	blamkaG(v1, v6, v11, v12)
+	blamkaG(v2, v7, v8, v13)
+	blamkaG(v3, v4, v9, v14)
+}
+
+func blamkaG(a, b, c, d *uint64) {
+	fBlaMka := func(x, y uint64) uint64 {
+		return x + y + 2*uint64(uint32(x))*uint64(uint32(y))
+	}
+	*a = fBlaMka(*a, *b)
+	*d = rotr(*d^*a, 32)
+	*c = fBlaMka(*c, *d)
+	*b = rotr(*b^*c, 24)
+	*a = fBlaMka(*a, *b)
+	*d = rotr(*d^*a, 16)
+	*c = fBlaMka(*c, *d)
+	*b = rotr(*b^*c, 63)
+}
+
+func rotr(x uint64, n uint) uint64 {
+	return x>>n | x<<(64-n)
+}
+
+func argon2Extract(blocks []argon2Block, memory, threads, keyLen uint32) []byte {
+	lanes := memory / threads
+	for lane := uint32(0); lane < threads-1; lane++ {
+		for i, v := range blocks[lane*lanes+lanes-1] {
+			blocks[memory-1][i] ^= v
+		}
+	}
+	var buf [1024]byte
+	for i, v := range blocks[memory-1] {
+		binary.LittleEndian.PutUint64(buf[i*8:], v)
+	}
+	key := make([]byte, keyLen)
+	blake2bLong(key, buf[:])
+	return key
+}
+
+// blake2bLong is the variable-length hash function H' of Argon2.
+func blake2bLong(out, in []byte) {
+	var b2 hash.Hash
+	if n := len(out); n < blake2b.Size {
+		b2, _ = blake2b.New(n, nil)
+	} else {
+		b2, _ = blake2b.New512(nil)
+	}
+	var lenBuf [4]byte
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(out)))
+	b2.Write(lenBuf[:])
+	b2.Write(in)
+	if len(out) <= blake2b.Size {
+		b2.Sum(out[:0])
+		return
+	}
+
+	outLen := len(out)
+	var v [blake2b.Size]byte
+	b2.Sum(v[:0])
+	copy(out, v[:32])
+	out = out[32:]
+	for len(out) > blake2b.Size {
+		b2.Reset()
+		b2.Write(v[:])
+		b2.Sum(v[:0])
+		copy(out, v[:32])
+		out = out[32:]
+	}
+	if outLen%blake2b.Size > 0 {
+		r := ((outLen + 31) / 32) - 2
+		b2, _ = blake2b.New(outLen-32*r, nil)
+	} else {
+		b2.Reset()
+	}
+	b2.Write(v[:])
+	b2.Sum(out[:0])
+}
@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package kdbx
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Standard attributes of entries.
+const (
+	AttrTitle    = "Title"
+	AttrUserName = "UserName"
+	AttrPassword = "Password"
+	AttrURL      = "URL"
+	AttrNotes    = "Notes"
+)
+
+// Database is a decrypted database.
+type Database struct {
+	// Entries are all entries, except old versions of them.
+	Entries []Entry
+}
+
+// Entry is an entry of a database.
+type Entry struct {
+	// Groups are the names of the groups containing the entry,
+	// from the outermost one, excluding the root group.
+	Groups []string
+	// Strings are the attributes of the entry, such as AttrPassword.
+	Strings map[string]string
+	// Binaries are the attachments of the entry, by name.
+	Binaries map[string][]byte
+}
+
+// Path returns the path of the entry, made of its group names and title
+// separated by slashes.
+func (e Entry) Path() string {
+	return strings.Join(append(append([]string(nil), e.Groups...), e.Strings[AttrTitle]), "/")
+}
+
+// Find returns the first entry whose Path is path. A leading slash in path is ignored.
+func (db *Database) Find(path string) (Entry, bool) {
+	path = strings.TrimPrefix(path, "/")
+	for _, entry := range db.Entries {
+		if entry.Path() == path {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// value is the content of a Value element.
+type value struct {
+	Text      string `xml:",chardata"`
+	Protected string `xml:"Protected,attr"`
+	Ref       string `xml:"Ref,attr"`
+}
+
+// readXML reads entries from the XML document of a database. Protected values
+// are XORed with stream, and attachments refer to binaries by index.
+func readXML(r io.Reader, stream keyStream, binaries [][]byte) (*Database, error) {
+	var (
+		db      Database
+		dec     = xml.NewDecoder(r)
+		stack   []string
+		groups  []string
+		entry   *Entry
+		history int
+		key     string
+	)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return &db, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			parent := ""
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			switch {
+			case tok.Name.Local == "Name" && parent == "Group":
+				var name string
+				err := dec.DecodeElement(&name, &tok)
+				if err != nil {
+					return nil, err
+				}
+				groups[len(groups)-1] = name
+				continue
+			case tok.Name.Local == "Key" && (parent == "String" || parent == "Binary"):
+				err := dec.DecodeElement(&key, &tok)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			case tok.Name.Local == "Value":
+				var val value
+				err := dec.DecodeElement(&val, &tok)
+				if err != nil {
+					return nil, err
+				}
+				if val.Protected == "True" {
+					data, err := base64.StdEncoding.DecodeString(val.Text)
+					if err != nil {
+						return nil, err
+					}
+					stream.XORKeyStream(data, data)
+					val.Text = string(data)
+				}
+				if entry == nil || history > 0 {
+					continue
+				}
+				switch parent {
+				case "String":
+					entry.Strings[key] = val.Text
+				case "Binary":
+					i, err := strconv.Atoi(val.Ref)
+					if err == nil && i >= 0 && i < len(binaries) {
+						entry.Binaries[key] = binaries[i]
+					}
+				}
+				continue
+			case tok.Name.Local == "Group":
+				groups = append(groups, "")
+			case tok.Name.Local == "History":
+				history++
+			case tok.Name.Local == "Entry" && history == 0:
+				entry = &Entry{
+					Strings:  make(map[string]string),
+					Binaries: make(map[string][]byte),
+				}
+				if len(groups) > 1 {
+					entry.Groups = append([]string(nil), groups[1:]...)
+				}
+			}
+			stack = append(stack, tok.Name.Local)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			switch {
+			case tok.Name.Local == "Group" && len(groups) > 0:
+				groups = groups[:len(groups)-1]
+			case tok.Name.Local == "History":
+				history--
+			case tok.Name.Local == "Entry" && history == 0 && entry != nil:
+				db.Entries = append(db.Entries, *entry)
+				entry = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package kdbx
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/salsa20"
+)
+
+func TestReadXML(t *testing.T) {
+	streamKey := []byte("inner stream key")
+	// Protected values are XORed with the same stream, in document order.
+	stream, _ := newInnerStream(streamChaCha20, streamKey)
+	protect := func(s string) string {
+		data := []byte(s)
+		stream.XORKeyStream(data, data)
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	doc := `<KeePassFile><Root><Group><Name>Root</Name>
+	<Entry>
+		<String><Key>Title</Key><Value>top</Value></String>
+		<String><Key>Password</Key><Value Protected="True">` + protect("toppass") + `</Value></String>
+		<History><Entry>
+			<String><Key>Title</Key><Value>top</Value></String>
+			<String><Key>Password</Key><Value Protected="True">` + protect("oldpass") + `</Value></String>
+		</Entry></History>
+	</Entry>
+	<Group><Name>Servers</Name>
+		<Entry>
+			<String><Key>Title</Key><Value>db</Value></String>
+			<String><Key>UserName</Key><Value>admin</Value></String>
+			<String><Key>Token</Key><Value Protected="True">` + protect("t0k3n") + `</Value></String>
+			<Binary><Key>id_ed25519</Key><Value Ref="1"/></Binary>
+		</Entry>
+	</Group>
+	</Group></Root></KeePassFile>`
+
+	stream, _ = newInnerStream(streamChaCha20, streamKey)
+	db, err := readXML(strings.NewReader(doc), stream, [][]byte{[]byte("zero"), []byte("one")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{
+			Strings:  map[string]string{"Title": "top", "Password": "toppass"},
+			Binaries: map[string][]byte{},
+		},
+		{
+			Groups:   []string{"Servers"},
+			Strings:  map[string]string{"Title": "db", "UserName": "admin", "Token": "t0k3n"},
+			Binaries: map[string][]byte{"id_ed25519": []byte("one")},
+		},
+	}
+	if !reflect.DeepEqual(db.Entries, expected) {
+		t.Fatalf("expected entries %v. Got %v", expected, db.Entries)
+	}
+	if _, ok := db.Find("/Servers/db"); !ok {
+		t.Fatal("expected to find /Servers/db")
+	}
+}
+
+func TestSalsa20Stream(t *testing.T) {
+	key := sha256.Sum256([]byte("key"))
+	expected := make([]byte, 150)
+	salsa20.XORKeyStream(expected, expected, []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}, &key)
+
+	parts, _ := newInnerStream(streamSalsa20, []byte("key"))
+	obtained := make([]byte, 150)
+	for _, part := range [][]byte{obtained[:10], obtained[10:64], obtained[64:65], obtained[65:]} {
+		parts.XORKeyStream(part, part)
+	}
+	if string(obtained) != string(expected) {
+		t.Fatalf("expected key stream %x. Got %x", expected, obtained)
+	}
+}
@@ -0,0 +1,354 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package kdbx reads KeePass databases in the KDBX 4 format,
+// used by KeePassXC and KeePass 2.35 and later.
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+var (
+	// ErrFormat is returned when a file is not a KDBX 4 database.
+	ErrFormat = errors.New("not a KDBX 4 database")
+	// ErrCredentials is returned when a database can't be opened
+	// with the given credentials, or the database is corrupted.
+	ErrCredentials = errors.New("wrong credentials or corrupted database")
+	// ErrUnsupported is returned when a database uses an unsupported algorithm.
+	ErrUnsupported = errors.New("unsupported algorithm")
+)
+
+const (
+	signature1   = 0x9AA2D903
+	signature2   = 0xB54BFB67
+	majorVersion = 4
+)
+
+// Outer header fields.
+const (
+	headerEnd         = 0
+	headerCipherID    = 2
+	headerCompression = 3
+	headerMasterSeed  = 4
+	headerIV          = 7
+	headerKDF         = 11
+)
+
+// Inner header fields.
+const (
+	innerEnd       = 0
+	innerStreamID  = 1
+	innerStreamKey = 2
+	innerBinary    = 3
+)
+
+var (
+	cipherAES256   = uuid("31c1f2e6bf714350be5805216afc5aff")
+	cipherChaCha20 = uuid("d6038a2b8b6f4cb5a524339a31dbb59a")
+	kdfAES         = uuid("c9d9f39a628a4460bf740d08c18a4fea")
+	kdfAESKDBX4    = uuid("7c02bb8279a74ac0927d114a00648238")
+	kdfArgon2d     = uuid("ef636ddf8c29444b91f7a9a403e30a0c")
+	kdfArgon2id    = uuid("9e298b1956db4773b23dfc3ec6f0a1e6")
+)
+
+// Credentials are the keys that unlock a database.
+type Credentials struct {
+	// Password is ignored when empty.
+	Password string
+	// KeyFile is the content of a key file. It is ignored when nil.
+	KeyFile []byte
+}
+
+// compositeKey returns the hash of all credentials.
+func (c Credentials) compositeKey() ([]byte, error) {
+	composite := sha256.New()
+	if c.Password != "" {
+		hash := sha256.Sum256([]byte(c.Password))
+		composite.Write(hash[:])
+	}
+	if c.KeyFile != nil {
+		hash, err := keyFileHash(c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		composite.Write(hash)
+	}
+	return composite.Sum(nil), nil
+}
+
+// header is the unencrypted header of a database.
+type header struct {
+	cipherID   [16]byte
+	compressed bool
+	masterSeed []byte
+	iv         []byte
+	kdf        variantDict
+}
+
+// Open decrypts the database read from r.
+func Open(r io.Reader, creds Credentials) (*Database, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	hdr, hdrLen, err := readHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < hdrLen+64 {
+		return nil, ErrFormat
+	}
+	hdrHash := sha256.Sum256(raw[:hdrLen])
+	if !bytes.Equal(hdrHash[:], raw[hdrLen:hdrLen+32]) {
+		return nil, fmt.Errorf("%w: header checksum mismatch", ErrFormat)
+	}
+
+	composite, err := creds.compositeKey()
+	if err != nil {
+		return nil, err
+	}
+	transformed, err := transformKey(hdr.kdf, composite)
+	if err != nil {
+		return nil, err
+	}
+	hmacKey := sha512.Sum512(append(append(bytes.Clone(hdr.masterSeed), transformed...), 1))
+	mac := hmac.New(sha256.New, blockKey(math.MaxUint64, hmacKey[:]))
+	mac.Write(raw[:hdrLen])
+	if !hmac.Equal(mac.Sum(nil), raw[hdrLen+32:hdrLen+64]) {
+		return nil, ErrCredentials
+	}
+
+	payload, err := readBlocks(raw[hdrLen+64:], hmacKey[:])
+	if err != nil {
+		return nil, err
+	}
+	masterKey := sha256.Sum256(append(bytes.Clone(hdr.masterSeed), transformed...))
+	plain, err := decrypt(hdr, masterKey[:], payload)
+	if err != nil {
+		return nil, err
+	}
+	if hdr.compressed {
+		gz, err := gzip.NewReader(bytes.NewReader(plain))
+		if err != nil {
+			return nil, err
+		}
+		plain, err = io.ReadAll(gz)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return readInner(plain)
+}
+
+func readHeader(raw []byte) (header, int, error) {
+	var hdr header
+	if len(raw) < 12 ||
+		binary.LittleEndian.Uint32(raw[0:]) != signature1 ||
+		binary.LittleEndian.Uint32(raw[4:]) != signature2 {
+		return hdr, 0, ErrFormat
+	}
+	if major := binary.LittleEndian.Uint16(raw[10:]); major != majorVersion {
+		return hdr, 0, fmt.Errorf("%w: version %d", ErrFormat, major)
+	}
+	pos := 12
+	for {
+		id, data, n, err := readField(raw[pos:])
+		if err != nil {
+			return hdr, 0, err
+		}
+		pos += n
+		switch id {
+		case headerEnd:
+			return hdr, pos, nil
+		case headerCipherID:
+			if len(data) != 16 {
+				return hdr, 0, ErrFormat
+			}
+			copy(hdr.cipherID[:], data)
+		case headerCompression:
+			hdr.compressed = len(data) == 4 && binary.LittleEndian.Uint32(data) == 1
+		case headerMasterSeed:
+			hdr.masterSeed = data
+		case headerIV:
+			hdr.iv = data
+		case headerKDF:
+			hdr.kdf, err = readVariantDict(data)
+			if err != nil {
+				return hdr, 0, err
+			}
+		}
+	}
+}
+
+// readField reads a header field made of a 1-byte ID, a 4-byte size and data.
+// It returns the number of bytes read.
+func readField(raw []byte) (byte, []byte, int, error) {
+	if len(raw) < 5 {
+		return 0, nil, 0, ErrFormat
+	}
+	size := binary.LittleEndian.Uint32(raw[1:])
+	if uint64(len(raw)-5) < uint64(size) {
+		return 0, nil, 0, ErrFormat
+	}
+	return raw[0], raw[5 : 5+size], 5 + int(size), nil
+}
+
+func transformKey(kdf variantDict, composite []byte) ([]byte, error) {
+	id := kdf.bytes("$UUID")
+	switch {
+	case bytes.Equal(id, kdfArgon2d[:]), bytes.Equal(id, kdfArgon2id[:]):
+		mode := argon2d
+		if bytes.Equal(id, kdfArgon2id[:]) {
+			mode = argon2id
+		}
+		memory := kdf.uint("M") / 1024
+		iterations, parallelism := kdf.uint("I"), kdf.uint("P")
+		if memory == 0 || iterations == 0 || parallelism == 0 ||
+			memory > math.MaxUint32 || iterations > math.MaxUint32 || parallelism > math.MaxUint8 {
+			return nil, fmt.Errorf("%w: invalid Argon2 parameters", ErrFormat)
+		}
+		return argon2Key(mode, composite, kdf.bytes("S"), kdf.bytes("K"), kdf.bytes("A"),
+			uint32(iterations), uint32(memory), uint32(parallelism), 32), nil
+	case bytes.Equal(id, kdfAES[:]), bytes.Equal(id, kdfAESKDBX4[:]):
+		block, err := aes.NewCipher(kdf.bytes("S"))
+		if err != nil {
+			return nil, err
+		}
+		key := bytes.Clone(composite)
+		for i := uint64(0); i < kdf.uint("R"); i++ {
+			block.Encrypt(key[:16], key[:16])
+			block.Encrypt(key[16:], key[16:])
+		}
+		hash := sha256.Sum256(key)
+		return hash[:], nil
+	default:
+		return nil, fmt.Errorf("%w: key derivation function %x", ErrUnsupported, id)
+	}
+}
+
+// blockKey returns the HMAC key of the payload block at index.
+func blockKey(index uint64, hmacKey []byte) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], index)
+	key := sha512.Sum512(append(buf[:], hmacKey...))
+	return key[:]
+}
+
+// readBlocks verifies and concatenates the HMAC blocks of the encrypted payload.
+func readBlocks(raw, hmacKey []byte) ([]byte, error) {
+	var payload []byte
+	for index := uint64(0); ; index++ {
+		if len(raw) < 36 {
+			return nil, ErrFormat
+		}
+		sum, size := raw[:32], binary.LittleEndian.Uint32(raw[32:36])
+		if uint64(len(raw)-36) < uint64(size) {
+			return nil, ErrFormat
+		}
+		data := raw[36 : 36+size]
+		var idx [8]byte
+		binary.LittleEndian.PutUint64(idx[:], index)
+		mac := hmac.New(sha256.New, blockKey(index, hmacKey))
+		mac.Write(idx[:])
+		mac.Write(raw[32:36])
+		mac.Write(data)
+		if !hmac.Equal(mac.Sum(nil), sum) {
+			return nil, fmt.Errorf("%w: block %d", ErrCredentials, index)
+		}
+		if size == 0 {
+			return payload, nil
+		}
+		payload = append(payload, data...)
+		raw = raw[36+size:]
+	}
+}
+
+func decrypt(hdr header, key, payload []byte) ([]byte, error) {
+	switch hdr.cipherID {
+	case cipherAES256:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(hdr.iv) != aes.BlockSize || len(payload)%aes.BlockSize != 0 || len(payload) == 0 {
+			return nil, ErrFormat
+		}
+		plain := make([]byte, len(payload))
+		cipher.NewCBCDecrypter(block, hdr.iv).CryptBlocks(plain, payload)
+		pad := int(plain[len(plain)-1])
+		if pad == 0 || pad > aes.BlockSize {
+			return nil, ErrCredentials
+		}
+		return plain[:len(plain)-pad], nil
+	case cipherChaCha20:
+		stream, err := chacha20.NewUnauthenticatedCipher(key, hdr.iv)
+		if err != nil {
+			return nil, err
+		}
+		plain := make([]byte, len(payload))
+		stream.XORKeyStream(plain, payload)
+		return plain, nil
+	default:
+		return nil, fmt.Errorf("%w: cipher %x", ErrUnsupported, hdr.cipherID)
+	}
+}
+
+// readInner reads the inner header and the XML document of the database.
+func readInner(plain []byte) (*Database, error) {
+	var (
+		streamID  uint32
+		streamKey []byte
+		binaries  [][]byte
+	)
+	for {
+		id, data, n, err := readField(plain)
+		if err != nil {
+			return nil, err
+		}
+		plain = plain[n:]
+		if id == innerEnd {
+			break
+		}
+		switch id {
+		case innerStreamID:
+			if len(data) != 4 {
+				return nil, ErrFormat
+			}
+			streamID = binary.LittleEndian.Uint32(data)
+		case innerStreamKey:
+			streamKey = data
+		case innerBinary:
+			if len(data) == 0 {
+				return nil, ErrFormat
+			}
+			// The first byte holds flags.
+			binaries = append(binaries, data[1:])
+		}
+	}
+	stream, err := newInnerStream(streamID, streamKey)
+	if err != nil {
+		return nil, err
+	}
+	return readXML(bytes.NewReader(plain), stream, binaries)
+}
+
+func uuid(s string) [16]byte {
+	var id [16]byte
+	hex.Decode(id[:], []byte(s))
+	return id
+}
@@ -0,0 +1,19 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package kdbx_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/livingsilver94/backee/repo/solver/kdbx"
+)
+
+func TestOpenNotKDBX(t *testing.T) {
+	_, err := kdbx.Open(strings.NewReader("definitely not a database"), kdbx.Credentials{Password: "x"})
+	if !errors.Is(err, kdbx.ErrFormat) {
+		t.Fatalf("expected %v. Got %v", kdbx.ErrFormat, err)
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// keyFileHash returns the key contained in a key file. Key files are
+// XML documents, 32 raw bytes, 64 hexadecimal digits, or any other file,
+// whose SHA-256 checksum is the key.
+func keyFileHash(data []byte) ([]byte, error) {
+	var doc struct {
+		XMLName xml.Name `xml:"KeyFile"`
+		Version string   `xml:"Meta>Version"`
+		Data    struct {
+			Hash  string `xml:"Hash,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Key>Data"`
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) && xml.Unmarshal(data, &doc) == nil {
+		switch {
+		case strings.HasPrefix(doc.Version, "1."):
+			return base64.StdEncoding.DecodeString(strings.TrimSpace(doc.Data.Value))
+		case strings.HasPrefix(doc.Version, "2."):
+			key, err := hex.DecodeString(strings.Join(strings.Fields(doc.Data.Value), ""))
+			if err != nil {
+				return nil, fmt.Errorf("invalid key file: %w", err)
+			}
+			sum := sha256.Sum256(key)
+			if doc.Data.Hash != "" && !strings.EqualFold(hex.EncodeToString(sum[:4]), doc.Data.Hash) {
+				return nil, fmt.Errorf("invalid key file: checksum mismatch")
+			}
+			return key, nil
+		default:
+			return nil, fmt.Errorf("invalid key file: unknown version %q", doc.Version)
+		}
+	}
+	switch len(data) {
+	case 32:
+		return data, nil
+	case 64:
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, nil
+		}
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestKeyFileHash(t *testing.T) {
+	key := bytes.Repeat([]byte{0xAB}, 32)
+	sum := sha256.Sum256(key)
+	hexKey := strings.ToUpper(hex.EncodeToString(key))
+	other := []byte("any file works as a key file")
+	otherSum := sha256.Sum256(other)
+	tests := []struct {
+		name     string
+		file     string
+		expected []byte
+	}{
+		{
+			name: "XML 2.0",
+			file: `<?xml version="1.0" encoding="utf-8"?>
+<KeyFile><Meta><Version>2.0</Version></Meta><Key>
+	<Data Hash="` + hex.EncodeToString(sum[:4]) + `">` + hexKey[:32] + "\n\t\t" + hexKey[32:] + `</Data>
+</Key></KeyFile>`,
+			expected: key,
+		},
+		{
+			name:     "XML 1.0",
+			file:     `<KeyFile><Meta><Version>1.00</Version></Meta><Key><Data>` + base64.StdEncoding.EncodeToString(key) + `</Data></Key></KeyFile>`,
+			expected: key,
+		},
+		{name: "raw", file: string(key), expected: key},
+		{name: "hex", file: hexKey, expected: key},
+		{name: "other", file: string(other), expected: otherSum[:]},
+	}
+	for _, test := range tests {
+		obtained, err := keyFileHash([]byte(test.file))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !bytes.Equal(obtained, test.expected) {
+			t.Fatalf("%s: expected key %x. Got %x", test.name, test.expected, obtained)
+		}
+	}
+
+	bad := `<KeyFile><Meta><Version>2.0</Version></Meta><Key><Data Hash="00000000">` + hexKey + `</Data></Key></KeyFile>`
+	_, err := keyFileHash([]byte(bad))
+	if err == nil {
+		t.Fatal("expected a checksum error")
+	}
+}
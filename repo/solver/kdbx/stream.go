@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package kdbx
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+)
+
+// Inner random stream algorithms, which protect values in the XML document.
+const (
+	streamSalsa20  = 2
+	streamChaCha20 = 3
+)
+
+// keyStream XORs protected values with a key stream, in document order.
+type keyStream interface {
+	XORKeyStream(dst, src []byte)
+}
+
+func newInnerStream(id uint32, key []byte) (keyStream, error) {
+	switch id {
+	case streamChaCha20:
+		hash := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(hash[:32], hash[32:44])
+	case streamSalsa20:
+		s := &salsa20Stream{key: sha256.Sum256(key)}
+		copy(s.counter[:8], []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A})
+		return s, nil
+	default:
+		return nil, fmt.Errorf("%w: inner stream %d", ErrUnsupported, id)
+	}
+}
+
+// salsa20Stream is a Salsa20 key stream that, unlike salsa20.XORKeyStream,
+// continues from where the previous call stopped.
+type salsa20Stream struct {
+	key     [32]byte
+	counter [16]byte
+	block   [64]byte
+	used    int
+}
+
+func (s *salsa20Stream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if s.used == 0 {
+			var zero [64]byte
+			salsa.XORKeyStream(s.block[:], zero[:], &s.counter, &s.key)
+			binary.LittleEndian.PutUint64(s.counter[8:], binary.LittleEndian.Uint64(s.counter[8:])+1)
+		}
+		dst[i] = src[i] ^ s.block[s.used]
+		s.used = (s.used + 1) % len(s.block)
+	}
+}
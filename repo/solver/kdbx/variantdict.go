@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package kdbx
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// variantDict is a KeePass VariantDictionary, holding
+// the raw values of key derivation parameters by name.
+type variantDict map[string][]byte
+
+func readVariantDict(raw []byte) (variantDict, error) {
+	if len(raw) < 2 || raw[1] != 1 {
+		return nil, fmt.Errorf("%w: unknown parameters version", ErrFormat)
+	}
+	raw = raw[2:]
+	dict := make(variantDict)
+	for {
+		if len(raw) < 1 {
+			return nil, ErrFormat
+		}
+		if raw[0] == 0 {
+			return dict, nil
+		}
+		key, n, err := readSized(raw[1:])
+		if err != nil {
+			return nil, err
+		}
+		raw = raw[1+n:]
+		val, n, err := readSized(raw)
+		if err != nil {
+			return nil, err
+		}
+		raw = raw[n:]
+		dict[string(key)] = val
+	}
+}
+
+// readSized reads data preceded by its 4-byte size.
+// It returns the number of bytes read.
+func readSized(raw []byte) ([]byte, int, error) {
+	if len(raw) < 4 {
+		return nil, 0, ErrFormat
+	}
+	size := binary.LittleEndian.Uint32(raw)
+	if uint64(len(raw)-4) < uint64(size) {
+		return nil, 0, ErrFormat
+	}
+	return raw[4 : 4+size], 4 + int(size), nil
+}
+
+func (d variantDict) bytes(key string) []byte {
+	return d[key]
+}
+
+// uint returns the value of key as an unsigned integer, or 0.
+func (d variantDict) uint(key string) uint64 {
+	switch val := d[key]; len(val) {
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(val))
+	case 8:
+		return binary.LittleEndian.Uint64(val)
+	default:
+		return 0
+	}
+}
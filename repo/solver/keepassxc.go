@@ -4,41 +4,124 @@
 package solver
 
 import (
-	"errors"
-	"io"
-	"os/exec"
+	"fmt"
+	"io/fs"
+	"os"
 	"strings"
+	"sync"
+
+	"github.com/livingsilver94/backee/repo/solver/kdbx"
+	"github.com/livingsilver94/backee/service"
 )
 
+// KeepassXCKind is the kind of variables solved by KeepassXC.
+const KeepassXCKind service.VarKind = "keepassxc"
+
+func init() {
+	service.RegisterVarKind(KeepassXCKind)
+}
+
+// KeepassXC reads entries of a KeePassXC database. The database
+// is decrypted once, on the first lookup, and kept in memory.
 type KeepassXC struct {
 	dbPath   string
 	password string
+	keyFile  string
+	prompt   Prompt
+
+	once sync.Once
+	db   *kdbx.Database
+	err  error
 }
 
-func NewKeepassXC(dbPath, password string) KeepassXC {
-	return KeepassXC{
+// NewKeepassXC returns a KeepassXC reading the database at dbPath.
+// keyFile is the path of a key file, and it's ignored if empty.
+func NewKeepassXC(dbPath, password, keyFile string) *KeepassXC {
+	return &KeepassXC{
 		dbPath:   dbPath,
 		password: password,
+		keyFile:  keyFile,
 	}
 }
 
-func (k KeepassXC) Value(key string) (string, error) {
-	cmd := exec.Command("keepassxc-cli", "show", "-sa", "password", k.dbPath, key)
+// WithPrompt makes k ask for the password with prompt
+// when it has neither a password nor a key file. It returns k.
+func (k *KeepassXC) WithPrompt(prompt Prompt) *KeepassXC {
+	k.prompt = prompt
+	return k
+}
 
-	in, err := cmd.StdinPipe()
-	if err != nil {
-		return "", err
+// Value returns the password of the entry at path key, such as "group/entry".
+// If key is in the form entry:attribute, Value returns the attribute
+// of the entry instead, which is either a standard attribute such as
+// UserName or URL, a custom attribute or the name of an attachment.
+// Attribute names are case-insensitive, unless multiple attributes match.
+func (k *KeepassXC) Value(key string) (string, error) {
+	k.once.Do(k.open)
+	if k.err != nil {
+		return "", k.err
+	}
+	entry, ok := k.db.Find(key)
+	attr := kdbx.AttrPassword
+	if !ok {
+		if i := strings.LastIndex(key, AttrSep); i >= 0 {
+			entry, ok = k.db.Find(key[:i])
+			key, attr = key[:i], key[i+len(AttrSep):]
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("KeePassXC entry %q: %w", key, fs.ErrNotExist)
+	}
+	if val, ok := lookupAttr(entry.Strings, attr); ok {
+		return val, nil
 	}
-	go func() {
-		io.WriteString(in, k.password+"\n")
-	}()
+	if val, ok := lookupAttr(entry.Binaries, attr); ok {
+		return string(val), nil
+	}
+	return "", fmt.Errorf("KeePassXC entry %q has no attribute or attachment %q", key, attr)
+}
 
-	value, err := cmd.Output()
+func (k *KeepassXC) open() {
+	file, err := os.Open(k.dbPath)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			err = errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		k.err = err
+		return
+	}
+	defer file.Close()
+	if k.password == "" && k.keyFile == "" && k.prompt != nil {
+		k.password, k.err = k.prompt("Password of " + k.dbPath)
+		if k.err != nil {
+			return
+		}
+	}
+	creds := kdbx.Credentials{Password: k.password}
+	if k.keyFile != "" {
+		creds.KeyFile, k.err = os.ReadFile(k.keyFile)
+		if k.err != nil {
+			return
+		}
+	}
+	k.db, k.err = kdbx.Open(file, creds)
+	if k.err != nil {
+		k.err = fmt.Errorf("opening %s: %w", k.dbPath, k.err)
+	}
+}
+
+// lookupAttr returns the value of name in attrs. If it's missing,
+// it returns the only value whose name matches case-insensitively.
+func lookupAttr[V any](attrs map[string]V, name string) (V, bool) {
+	if val, ok := attrs[name]; ok {
+		return val, true
+	}
+	var (
+		found V
+		n     int
+	)
+	for attr, val := range attrs {
+		if strings.EqualFold(attr, name) {
+			found = val
+			n++
 		}
-		return "", err
 	}
-	return strings.TrimSuffix(string(value), "\n"), nil
+	return found, n == 1
 }
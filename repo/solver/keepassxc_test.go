@@ -5,23 +5,88 @@ package solver_test
 
 import (
 	"errors"
-	"os/exec"
+	"io/fs"
 	"path/filepath"
 	"testing"
 
 	"github.com/livingsilver94/backee/repo/solver"
+	"github.com/livingsilver94/backee/repo/solver/kdbx"
 )
 
 func TestKeepassXC(t *testing.T) {
-	k := solver.NewKeepassXC(filepath.Join("testdata", "keepassxc.kdbx"), "password")
+	k := solver.NewKeepassXC(filepath.Join("testdata", "keepassxc.kdbx"), "password", "")
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{key: "test", expected: "testvalue"},
+		{key: "/test", expected: "testvalue"},
+		{key: "test:Password", expected: "testvalue"},
+		{key: "test:title", expected: "test"},
+		{key: "test:UserName", expected: ""},
+	}
+	for _, test := range tests {
+		val, err := k.Value(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != test.expected {
+			t.Fatalf("expected value %q for %q. Got %q", test.expected, test.key, val)
+		}
+	}
+	_, err := k.Value("missing")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected %v. Got %v", fs.ErrNotExist, err)
+	}
+	_, err = k.Value("test:missing")
+	if err == nil {
+		t.Fatal("expected an error for a missing attribute")
+	}
+}
+
+func TestKeepassXCAESKDF(t *testing.T) {
+	k := solver.NewKeepassXC(filepath.Join("testdata", "keepassxc-aeskdf.kdbx"), "password", "")
 	val, err := k.Value("test")
 	if err != nil {
-		if errors.Is(err, exec.ErrNotFound) {
-			t.Skip("KeepassXC not installed")
-		}
 		t.Fatal(err)
 	}
 	if val != "testvalue" {
 		t.Fatalf("expected value %q. Got %q", "testvalue", val)
 	}
 }
+
+func TestKeepassXCWrongPassword(t *testing.T) {
+	k := solver.NewKeepassXC(filepath.Join("testdata", "keepassxc.kdbx"), "wrong", "")
+	_, err := k.Value("test")
+	if !errors.Is(err, kdbx.ErrCredentials) {
+		t.Fatalf("expected %v. Got %v", kdbx.ErrCredentials, err)
+	}
+}
+
+func TestKeepassXCPrompt(t *testing.T) {
+	var prompts int
+	k := solver.NewKeepassXC(filepath.Join("testdata", "keepassxc.kdbx"), "", "").WithPrompt(func(string) (string, error) {
+		prompts++
+		return "password", nil
+	})
+	for i := 0; i < 2; i++ {
+		val, err := k.Value("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "testvalue" {
+			t.Fatalf("expected value %q. Got %q", "testvalue", val)
+		}
+	}
+	if prompts != 1 {
+		t.Fatalf("expected 1 prompt. Got %d", prompts)
+	}
+
+	errPrompt := errors.New("not a terminal")
+	k = solver.NewKeepassXC(filepath.Join("testdata", "keepassxc.kdbx"), "", "").WithPrompt(func(string) (string, error) {
+		return "", errPrompt
+	})
+	if _, err := k.Value("test"); !errors.Is(err, errPrompt) {
+		t.Fatalf("expected %v. Got %v", errPrompt, err)
+	}
+}
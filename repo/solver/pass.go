@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package solver
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/livingsilver94/backee/service"
+)
+
+// PassKind is the kind of variables solved by Pass.
+const PassKind service.VarKind = "pass"
+
+func init() {
+	service.RegisterVarKind(PassKind)
+}
+
+// Pass reads entries of a password store of pass, the standard UNIX
+// password manager, by decrypting them with GnuPG.
+type Pass struct {
+	dir string
+}
+
+// NewPass returns a Pass reading the password store in dir.
+// When dir is empty, it is $PASSWORD_STORE_DIR, or ~/.password-store.
+func NewPass(dir string) Pass {
+	if dir == "" {
+		dir = os.Getenv("PASSWORD_STORE_DIR")
+	}
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".password-store")
+	}
+	return Pass{dir: dir}
+}
+
+// Value returns the first line of the entry named key, such as "email/work".
+// If key is in the form entry:field, Value returns the value of the line
+// "field: value" of the entry instead. Field names are case-insensitive.
+func (p Pass) Value(key string) (string, error) {
+	entry, field := key, ""
+	if _, err := os.Stat(p.entryPath(key)); err != nil {
+		if i := strings.LastIndex(key, AttrSep); i >= 0 {
+			entry, field = key[:i], key[i+len(AttrSep):]
+		}
+	}
+	if !filepath.IsLocal(entry) {
+		return "", fmt.Errorf("invalid password store entry %q", entry)
+	}
+	path := p.entryPath(entry)
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("password store entry %q: %w", entry, fs.ErrNotExist)
+		}
+		return "", err
+	}
+
+	cmd := exec.Command("gpg", "--quiet", "--batch", "--decrypt", path)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			err = errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(out), "\r\n", "\n"), "\n")
+	if field == "" {
+		return lines[0], nil
+	}
+	for _, line := range lines[1:] {
+		name, val, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), field) {
+			return strings.TrimSpace(val), nil
+		}
+	}
+	return "", fmt.Errorf("password store entry %q has no field %q", entry, field)
+}
+
+func (p Pass) entryPath(entry string) string {
+	return filepath.Join(p.dir, filepath.FromSlash(entry)+".gpg")
+}
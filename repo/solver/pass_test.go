@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package solver_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/livingsilver94/backee/repo/solver"
+)
+
+func TestPass(t *testing.T) {
+	store := newPassStore(t, map[string]string{
+		"email/work": "s3cret\nlogin: me@example.com\nURL: https://mail.example.com\n",
+		"host:port":  "colon\n",
+	})
+	p := solver.NewPass(store)
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{key: "email/work", expected: "s3cret"},
+		{key: "email/work:login", expected: "me@example.com"},
+		{key: "email/work:url", expected: "https://mail.example.com"},
+		{key: "host:port", expected: "colon"},
+	}
+	for _, test := range tests {
+		val, err := p.Value(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != test.expected {
+			t.Fatalf("expected value %q for %q. Got %q", test.expected, test.key, val)
+		}
+	}
+	_, err := p.Value("email/personal")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected %v. Got %v", fs.ErrNotExist, err)
+	}
+	_, err = p.Value("email/work:pin")
+	if err == nil {
+		t.Fatal("expected an error for a missing field")
+	}
+	_, err = p.Value("../outside")
+	if err == nil {
+		t.Fatal("expected an error for an entry outside the store")
+	}
+}
+
+// newPassStore creates a password store with entries, encrypted
+// with the key of a throwaway GnuPG home.
+func newPassStore(t *testing.T, entries map[string]string) string {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("GnuPG not installed")
+	}
+	// Keep the path short: it hosts the agent's socket.
+	home, err := os.MkdirTemp("", "gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--homedir", home, "--kill", "gpg-agent").Run()
+		os.RemoveAll(home)
+	})
+	t.Setenv("GNUPGHOME", home)
+	gpg := func(stdin string, args ...string) {
+		cmd := exec.Command("gpg", append([]string{"--batch", "--quiet"}, args...)...)
+		cmd.Stdin = strings.NewReader(stdin)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("gpg %v: %v: %s", args, err, out)
+		}
+	}
+	const recipient = "backee@example.com"
+	gpg("", "--passphrase", "", "--quick-generate-key", recipient, "default", "default", "never")
+
+	store := t.TempDir()
+	for name, content := range entries {
+		path := filepath.Join(store, filepath.FromSlash(name)+".gpg")
+		os.MkdirAll(filepath.Dir(path), 0700)
+		gpg(content, "--trust-model", "always", "--recipient", recipient, "--output", path, "--encrypt")
+	}
+	return store
+}
@@ -0,0 +1,13 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+// Package solver provides the solvers of variables that are not ClearText.
+package solver
+
+// Prompt asks the user for a credential described by msg,
+// without echoing it, and returns it.
+type Prompt func(msg string) (string, error)
+
+// AttrSep separates the name of an entry of a secret manager
+// from the name of one of its attributes, in variable values.
+const AttrSep = ":"
@@ -0,0 +1,199 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/livingsilver94/backee/service"
+	"gopkg.in/yaml.v3"
+)
+
+// Validate checks the service named name, and returns the problems found.
+// Besides those reported by service.Check, they are link and copy sources
+// that don't exist, dependencies that don't resolve and placeholders
+// that refer to unknown variables. common are the names of the variables
+// available to all services, such as environment variables.
+func (repo FS) Validate(name string, common []string) service.Diagnostics {
+	srv, err := repo.Service(name)
+	if err != nil {
+		return service.Diagnose(err)
+	}
+	_, files, err := repo.ServiceNode(name)
+	if err != nil {
+		return service.Diagnose(err)
+	}
+	v := validator{
+		repo:  repo,
+		srv:   srv,
+		known: knownVars(srv, common),
+	}
+	for _, file := range files {
+		v.file(file)
+	}
+	_, err = repo.ResolveDeps(srv)
+	var cycle *CycleError
+	if errors.As(err, &cycle) {
+		v.diags = append(v.diags, service.Diagnostic{File: files[len(files)-1], Msg: err.Error()})
+	}
+	return v.diags
+}
+
+// knownVars returns the set of variables that srv can refer to.
+// Variables of dependencies aren't included, since installing
+// doesn't resolve them.
+func knownVars(srv *service.Service, common []string) map[string]struct{} {
+	known := make(map[string]struct{}, len(srv.Variables)+len(common))
+	for name := range srv.Variables {
+		known[name] = struct{}{}
+	}
+	for _, name := range common {
+		known[name] = struct{}{}
+	}
+	return known
+}
+
+// validator checks the files that define a service.
+type validator struct {
+	repo  FS
+	srv   *service.Service
+	known map[string]struct{}
+	// fpath is the path of the file being checked.
+	fpath string
+	diags service.Diagnostics
+}
+
+func (v *validator) file(fpath string) {
+	v.fpath = fpath
+	data, err := fs.ReadFile(v.repo.baseFS, fpath)
+	if err != nil {
+		v.report(service.Diagnostic{Msg: err.Error()})
+		return
+	}
+	var doc yaml.Node
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return
+	}
+	root := doc.Content[0]
+	for i := 0; i < len(root.Content)-1; i += 2 {
+		val := root.Content[i+1]
+		switch root.Content[i].Value {
+		case "depends":
+			for _, dep := range val.Content {
+				_, err := v.repo.ServiceLayers(dep.Value)
+				if err != nil {
+					v.report(service.At(dep, "unknown service %q", dep.Value))
+				}
+			}
+		case "links":
+			v.files(val, fsRepoBaseLinkDir, v.srv.Links, false)
+		case "copies":
+			v.files(val, fsRepoBaseDataDir, v.srv.Copies, true)
+		case "finalize", "uninstall":
+			if val.Kind == yaml.MappingNode {
+				for j := 0; j < len(val.Content)-1; j += 2 {
+					if val.Content[j].Value == "run" {
+						v.placeholders(val.Content[j+1])
+					}
+				}
+			} else {
+				v.placeholders(val)
+			}
+		}
+	}
+}
+
+// files checks the sources in dir and the destinations of links or copies,
+// ignoring those that aren't in entries. When copied is true,
+// the content of sources is checked too.
+func (v *validator) files(node *yaml.Node, dir string, entries map[string]service.FilePath, copied bool) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		fp, ok := entries[key.Value]
+		if !ok {
+			continue
+		}
+		src := path.Join(v.srv.Name, dir, key.Value)
+		_, err := fs.Stat(v.repo.baseFS, src)
+		if err != nil {
+			v.report(service.At(key, "source %s does not exist", src))
+		}
+		if val.Kind == yaml.MappingNode {
+			for j := 0; j < len(val.Content)-1; j += 2 {
+				if val.Content[j].Value == "path" {
+					v.placeholders(val.Content[j+1])
+				}
+			}
+		} else {
+			v.placeholders(val)
+		}
+		if err == nil && copied && fp.EngineFor(key.Value) == service.EnginePlain {
+			v.content(src)
+		}
+	}
+}
+
+// placeholders checks the variables that the scalar node refers to.
+func (v *validator) placeholders(node *yaml.Node) {
+	if node.Kind != yaml.ScalarNode {
+		return
+	}
+	for _, name := range service.Placeholders(node.Value) {
+		if _, ok := v.known[name]; !ok {
+			v.report(service.At(node, "unknown variable %q", name))
+		}
+	}
+}
+
+// content checks the variables that the file src refers to.
+func (v *validator) content(src string) {
+	info, err := fs.Stat(v.repo.baseFS, src)
+	if err != nil || info.IsDir() {
+		return
+	}
+	data, err := fs.ReadFile(v.repo.baseFS, src)
+	if err != nil {
+		v.report(service.Diagnostic{File: src, Msg: err.Error()})
+		return
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		offset := 0
+		for {
+			start := strings.Index(line[offset:], service.VarOpenTag)
+			if start < 0 {
+				break
+			}
+			start += offset
+			end := strings.Index(line[start:], service.VarCloseTag)
+			if end < 0 {
+				break
+			}
+			name := line[start+len(service.VarOpenTag) : start+end]
+			offset = start + end + len(service.VarCloseTag)
+			if _, ok := v.known[name]; !ok {
+				v.report(service.Diagnostic{File: src, Line: i + 1, Column: start + 1, Msg: fmt.Sprintf("unknown variable %q", name)})
+			}
+		}
+	}
+}
+
+// report adds d to the problems found. d is in the file
+// being checked, unless it has its own.
+func (v *validator) report(d service.Diagnostic) {
+	if d.File == "" {
+		d.File = v.fpath
+	}
+	if !slices.Contains(v.diags, d) {
+		v.diags = append(v.diags, d)
+	}
+}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/livingsilver94/backee/repo"
+)
+
+func TestValidate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base/service.yaml": &fstest.MapFile{Data: []byte("variables: {port: 80}")},
+		"srv/service.yaml": &fstest.MapFile{Data: []byte(`depends: [base, ghost]
+variables: {user: me}
+links: {present: "{{HOME}}/a", absent: /b}
+copies: {conf: "/etc/{{user}}/{{nope}}"}
+finalize: echo {{base.port}} {{base.host}}`)},
+		"srv/links/present": &fstest.MapFile{},
+		"srv/data/conf":     &fstest.MapFile{Data: []byte("user={{user}}\nport={{port}}")},
+	}
+	expected := []string{
+		`srv/service.yaml:1:17: unknown service "ghost"`,
+		`srv/service.yaml:3:32: source srv/links/absent does not exist`,
+		`srv/service.yaml:4:16: unknown variable "nope"`,
+		`srv/data/conf:2:6: unknown variable "port"`,
+		`srv/service.yaml:5:11: unknown variable "base.port"`,
+		`srv/service.yaml:5:11: unknown variable "base.host"`,
+	}
+	diags := repo.NewFS(fsys).Validate("srv", []string{"HOME"})
+	if len(diags) != len(expected) {
+		t.Fatalf("expected %d problems. Got %v", len(expected), diags)
+	}
+	for i, diag := range diags {
+		if diag.Error() != expected[i] {
+			t.Fatalf("expected problem %q. Got %q", expected[i], diag.Error())
+		}
+	}
+}
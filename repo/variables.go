@@ -8,7 +8,9 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"sync"
 
+	"github.com/livingsilver94/backee/redact"
 	"github.com/livingsilver94/backee/service"
 )
 
@@ -27,6 +29,11 @@ type VarSolver interface {
 }
 
 // Variables resolves and caches services' variables.
+// Solvers are called once for each kind and value, even if
+// multiple services share the variable.
+// Values returned by solvers, except the one of service.Datadir,
+// are secrets, and are added to the redactor of output.
+// It is safe for concurrent use, as long as Common is not modified.
 type Variables struct {
 	// Common is an optional collection of variables that services
 	// might have in common. It is initially nil.
@@ -34,12 +41,27 @@ type Variables struct {
 
 	resolved map[string]value
 	solvers  map[service.VarKind]VarSolver
+	// solved caches what solvers returned.
+	solved map[service.VarValue]*solution
+	mu     *sync.RWMutex
+	// secrets masks values that come from solvers.
+	secrets *redact.Redactor
+}
+
+// solution is the result of a solver, computed once.
+type solution struct {
+	once  sync.Once
+	value string
+	err   error
 }
 
 func NewVariables() Variables {
 	return Variables{
 		resolved: make(map[string]value),
 		solvers:  make(map[service.VarKind]VarSolver),
+		solved:   make(map[service.VarValue]*solution),
+		mu:       &sync.RWMutex{},
+		secrets:  redact.Default,
 	}
 }
 
@@ -48,6 +70,8 @@ func NewVariables() Variables {
 // Get parent's variables as well when Getting srv's variables.
 // AddParent returns ErrNoService if srv or parent does not exist.
 func (vars Variables) AddParent(srv, parent string) error {
+	vars.mu.Lock()
+	defer vars.mu.Unlock()
 	val, ok := vars.resolved[srv]
 	if !ok {
 		return errNoService(srv)
@@ -64,32 +88,62 @@ func (vars Variables) AddParent(srv, parent string) error {
 // If the value is not clear text, it is resolved immediately and then cached.
 // If key is already present for srv, Insert is no-op.
 func (vars Variables) Insert(srv, key string, val service.VarValue) error {
-	_, err := vars.Get(srv, key)
+	vars.mu.RLock()
+	_, err := vars.get(srv, key)
+	var solv VarSolver
+	if err != nil && val.Kind != service.ClearText {
+		solv = vars.solvers[val.Kind]
+	}
+	vars.mu.RUnlock()
 	if err == nil {
 		return nil
 	}
-	if errors.Is(err, ErrNoService) {
-		vars.resolved[srv] = value{Vars: make(map[string]string)}
-	}
 
 	var v string
 	if kind := val.Kind; kind == service.ClearText {
 		v = val.Value
 	} else {
-		solv, ok := vars.solvers[kind]
-		if !ok {
+		if solv == nil {
 			return fmt.Errorf("no variable store registered for kind %q", kind)
 		}
 		var err error
-		v, err = solv.Value(val.Value)
+		v, err = vars.solve(solv, val)
 		if err != nil {
 			return err
 		}
 	}
-	vars.resolved[srv].Vars[key] = v
+
+	vars.mu.Lock()
+	defer vars.mu.Unlock()
+	if _, ok := vars.resolved[srv]; !ok {
+		vars.resolved[srv] = value{Vars: make(map[string]string)}
+	}
+	if _, ok := vars.resolved[srv].Vars[key]; !ok {
+		vars.resolved[srv].Vars[key] = v
+	}
 	return nil
 }
 
+// solve returns the value solv gives to val, calling it only the first time.
+// Errors are cached too, so that solvers don't ask for credentials again.
+func (vars Variables) solve(solv VarSolver, val service.VarValue) (string, error) {
+	vars.mu.Lock()
+	sol, ok := vars.solved[val]
+	if !ok {
+		sol = &solution{}
+		vars.solved[val] = sol
+	}
+	vars.mu.Unlock()
+	// Solvers may be slow, so don't hold the lock meanwhile.
+	sol.once.Do(func() {
+		sol.value, sol.err = solv.Value(val.Value)
+		if sol.err == nil && val.Kind != service.Datadir {
+			vars.secrets.Add(sol.value)
+		}
+	})
+	return sol.value, sol.err
+}
+
 // InsertMany is a convenience method to Insert multiple values.
 func (vars Variables) InsertMany(srv string, values map[string]service.VarValue) error {
 	for key, value := range values {
@@ -101,9 +155,30 @@ func (vars Variables) InsertMany(srv string, values map[string]service.VarValue)
 	return nil
 }
 
+// All returns the variables of srv, including common variables
+// that srv does not override. Variables of parents are not included.
+func (vars Variables) All(srv string) (map[string]string, error) {
+	vars.mu.RLock()
+	defer vars.mu.RUnlock()
+	val, ok := vars.resolved[srv]
+	if !ok {
+		return nil, errNoService(srv)
+	}
+	all := make(map[string]string, len(vars.Common)+len(val.Vars))
+	for k, v := range vars.Common {
+		all[k] = v
+	}
+	for k, v := range val.Vars {
+		all[k] = v
+	}
+	return all, nil
+}
+
 // Parents returns the parent list of srv.
 // If srv does not exist, ErrNoService is returned.
 func (vars Variables) Parents(srv string) ([]string, error) {
+	vars.mu.RLock()
+	defer vars.mu.RUnlock()
 	val, ok := vars.resolved[srv]
 	if !ok {
 		return nil, errNoService(srv)
@@ -115,6 +190,12 @@ func (vars Variables) Parents(srv string) ([]string, error) {
 // If srv does not exist, ErrNoService is returned.
 // If key does not exist, ErrNoVariable is returned.
 func (vars Variables) Get(srv, key string) (string, error) {
+	vars.mu.RLock()
+	defer vars.mu.RUnlock()
+	return vars.get(srv, key)
+}
+
+func (vars Variables) get(srv, key string) (string, error) {
 	val, ok := vars.resolved[srv]
 	if !ok {
 		return "", errNoService(srv)
@@ -132,16 +213,22 @@ func (vars Variables) Get(srv, key string) (string, error) {
 
 // Length returns how many variables were cached.
 func (vars Variables) Length() int {
+	vars.mu.RLock()
+	defer vars.mu.RUnlock()
 	return len(vars.resolved)
 }
 
 // RegisterSolver registers a VarSolver for a VarKind.
 func (vars Variables) RegisterSolver(kind service.VarKind, solv VarSolver) {
+	vars.mu.Lock()
+	defer vars.mu.Unlock()
 	vars.solvers[kind] = solv
 }
 
 // GobEncode implements the gob.GobEncoder interface.
 func (vars Variables) GobEncode() ([]byte, error) {
+	vars.mu.RLock()
+	defer vars.mu.RUnlock()
 	buf := &bytes.Buffer{}
 	enc := gob.NewEncoder(buf)
 	err := enc.Encode(vars.Common)
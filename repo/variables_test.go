@@ -5,9 +5,13 @@ package repo_test
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 
+	"github.com/livingsilver94/backee/redact"
 	"github.com/livingsilver94/backee/repo"
 	"github.com/livingsilver94/backee/service"
 )
@@ -68,6 +72,59 @@ func TestInsertVarStore(t *testing.T) {
 	}
 }
 
+// countingSolver counts its calls, and fails for "fail".
+type countingSolver struct {
+	calls *atomic.Int32
+}
+
+func (s countingSolver) Value(key string) (string, error) {
+	s.calls.Add(1)
+	if key == "fail" {
+		return "", errors.New("locked")
+	}
+	return "solved" + key, nil
+}
+
+func TestInsertSolvedOnce(t *testing.T) {
+	const kind service.VarKind = "testKind"
+	solv := countingSolver{calls: &atomic.Int32{}}
+	cache := repo.NewVariables()
+	cache.RegisterSolver(kind, solv)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(srv string) {
+			defer wg.Done()
+			cache.Insert(srv, "key", service.VarValue{Kind: kind, Value: "db"})
+			cache.Insert(srv, "bad", service.VarValue{Kind: kind, Value: "fail"})
+		}(fmt.Sprint("srv", i))
+	}
+	wg.Wait()
+	if n := solv.calls.Load(); n != 2 {
+		t.Fatalf("expected 2 solver calls. Got %d", n)
+	}
+	if v, _ := cache.Get("srv7", "key"); v != "solveddb" {
+		t.Fatalf("expected value %q. Got %q", "solveddb", v)
+	}
+	err := cache.Insert("other", "bad", service.VarValue{Kind: kind, Value: "fail"})
+	if err == nil {
+		t.Fatal("expected the cached error")
+	}
+}
+
+func TestInsertSecret(t *testing.T) {
+	cache := repo.NewVariables()
+	cache.RegisterSolver("testKind", testVarStore{})
+	cache.RegisterSolver(service.Datadir, testVarStore{})
+	cache.Insert(serviceName, "secret", service.VarValue{Kind: "testKind", Value: "Secret"})
+	cache.Insert(serviceName, "dir", service.VarValue{Kind: service.Datadir, Value: "Dir"})
+	cache.Insert(serviceName, "clear", service.VarValue{Kind: service.ClearText, Value: "testyClear"})
+	const expected = redact.Mask + " testyDir testyClear"
+	if s := redact.Default.String("testySecret testyDir testyClear"); s != expected {
+		t.Fatalf("expected only solved secrets to be masked: %q. Got %q", expected, s)
+	}
+}
+
 func TestGet(t *testing.T) {
 	cache := createVariables("key", "value")
 	value, ok := cache.Get(serviceName, "key")
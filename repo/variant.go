@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/livingsilver94/backee/facts"
+)
+
+// VariantCandidates returns the system variants matching the host
+// described by f, most specific first: tags as passed, the hostname,
+// the distribution ID with its version, the distribution ID,
+// the distributions it is alike, and the operating system.
+func VariantCandidates(f facts.Facts, tags []string) []string {
+	candidates := make([]string, 0, len(tags)+5)
+	add := func(variant string) {
+		if variant != "" && !slices.Contains(candidates, variant) {
+			candidates = append(candidates, variant)
+		}
+	}
+	for _, tag := range tags {
+		add(tag)
+	}
+	add(f["hostname"])
+	if id, ver := f["distro.id"], f["distro.version"]; id != "" && ver != "" {
+		add(id + "-" + ver)
+	}
+	add(f["distro.id"])
+	for _, like := range strings.Fields(f["distro.like"]) {
+		add(like)
+	}
+	add(f["os"])
+	return candidates
+}
@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package repo_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/livingsilver94/backee/facts"
+	"github.com/livingsilver94/backee/repo"
+)
+
+func TestVariantCandidates(t *testing.T) {
+	f := facts.Facts{
+		"os":             "linux",
+		"hostname":       "laptop",
+		"distro.id":      "ubuntu",
+		"distro.version": "24.04",
+		"distro.like":    "debian",
+	}
+	expected := []string{"work", "laptop", "ubuntu-24.04", "ubuntu", "debian", "linux"}
+	obtained := repo.VariantCandidates(f, []string{"work", "laptop"})
+	if !slices.Equal(obtained, expected) {
+		t.Fatalf("expected %v. Got %v", expected, obtained)
+	}
+}
@@ -0,0 +1,291 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/livingsilver94/backee/expr"
+	"gopkg.in/yaml.v3"
+)
+
+// MaxMode is the highest file mode that a FilePath accepts.
+const MaxMode = 0o7777
+
+// Diagnostic is a problem found in a YAML document.
+type Diagnostic struct {
+	// File is the path of the document. It may be empty.
+	File string
+	// Line and Column are the 1-based position of the problem.
+	// They are zero when unknown.
+	Line   int
+	Column int
+	Msg    string
+}
+
+// At returns a Diagnostic about node.
+func At(node *yaml.Node, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		Line:   node.Line,
+		Column: node.Column,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+func (d Diagnostic) Error() string {
+	var pos strings.Builder
+	pos.WriteString(d.File)
+	if d.Line > 0 {
+		fmt.Fprintf(&pos, ":%d", d.Line)
+		if d.Column > 0 {
+			fmt.Fprintf(&pos, ":%d", d.Column)
+		}
+	}
+	if pos.Len() == 0 {
+		return d.Msg
+	}
+	return strings.TrimPrefix(pos.String(), ":") + ": " + d.Msg
+}
+
+// Diagnostics is a list of problems. It's an error when not empty.
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	msgs := make([]string, 0, len(ds))
+	for _, d := range ds {
+		msgs = append(msgs, d.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// InFile sets the File of all ds to file.
+func (ds Diagnostics) InFile(file string) Diagnostics {
+	for i := range ds {
+		ds[i].File = file
+	}
+	return ds
+}
+
+// Diagnose converts an error returned by the YAML parser into Diagnostics,
+// extracting the line numbers from its messages.
+func Diagnose(err error) Diagnostics {
+	var diags Diagnostics
+	if errors.As(err, &diags) {
+		return diags
+	}
+	var msgs []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+	diags = make(Diagnostics, 0, len(msgs))
+	for _, msg := range msgs {
+		msg = strings.TrimPrefix(msg, "yaml: ")
+		var d Diagnostic
+		_, scanErr := fmt.Sscanf(msg, "line %d:", &d.Line)
+		if scanErr == nil {
+			_, msg, _ = strings.Cut(msg, ": ")
+		}
+		d.Msg = msg
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+// Check reports the problems of a YAML document defining a Service:
+// unknown keys, values of the wrong type, file modes out of range,
+// unregistered variable kinds and invalid conditions.
+// Check does not modify doc.
+func Check(doc *yaml.Node) Diagnostics {
+	if doc.Kind == 0 {
+		return nil
+	}
+	if doc.Kind == yaml.DocumentNode {
+		if len(doc.Content) == 0 {
+			return nil
+		}
+		doc = doc.Content[0]
+	}
+	var diags Diagnostics
+	checkKeys(doc, reflect.TypeOf(Service{}), &diags)
+
+	// Tags are meant for merging: decode without them.
+	var srv Service
+	err := untag(doc).Decode(&srv)
+	if err != nil {
+		diags = append(diags, Diagnose(err)...)
+	}
+	if doc.Kind != yaml.MappingNode {
+		return diags
+	}
+	for i := 0; i < len(doc.Content)-1; i += 2 {
+		key, val := doc.Content[i].Value, doc.Content[i+1]
+		switch key {
+		case "links", "copies":
+			forEachValue(val, func(fp *yaml.Node) {
+				if mode := valueOf(fp, "mode"); mode != nil {
+					var m uint32
+					if mode.Decode(&m) == nil && m > MaxMode {
+						diags = append(diags, At(mode, "file mode 0o%o is out of range", m))
+					}
+				}
+				checkWhen(valueOf(fp, "when"), &diags)
+			})
+		case "variables":
+			forEachValue(val, func(v *yaml.Node) {
+				kind := valueOf(v, "kind")
+				if kind != nil && kind.Kind == yaml.ScalarNode && !IsVarKind(VarKind(kind.Value)) {
+					diags = append(diags, At(kind, "unknown variable kind %q; known kinds are %s", kind.Value, joinKinds()))
+				}
+			})
+		case "packages":
+			if val.Kind == yaml.SequenceNode {
+				for _, pkg := range val.Content {
+					checkWhen(valueOf(pkg, "when"), &diags)
+				}
+			}
+		case "setup", "finalize", "uninstall":
+			checkWhen(valueOf(val, "when"), &diags)
+		}
+	}
+	return diags
+}
+
+// checkKeys reports keys of node that the YAML tags of typ don't define.
+func checkKeys(node *yaml.Node, typ reflect.Type, diags *Diagnostics) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		switch typ.Kind() {
+		case reflect.Struct:
+			fields := yamlFields(typ)
+			if len(fields) == 0 {
+				return
+			}
+			for i := 0; i < len(node.Content)-1; i += 2 {
+				key := node.Content[i]
+				field, ok := fields[key.Value]
+				if !ok {
+					*diags = append(*diags, At(key, "unknown key %q%s", key.Value, suggest(key.Value, fields)))
+					continue
+				}
+				checkKeys(node.Content[i+1], field, diags)
+			}
+		case reflect.Map:
+			for i := 1; i < len(node.Content); i += 2 {
+				checkKeys(node.Content[i], typ.Elem(), diags)
+			}
+		}
+	case yaml.SequenceNode:
+		if typ.Kind() == reflect.Slice {
+			for _, item := range node.Content {
+				checkKeys(item, typ.Elem(), diags)
+			}
+		}
+	}
+}
+
+// yamlFields returns the types of the fields of the struct typ
+// by their YAML key. Fields without a YAML tag are ignored.
+func yamlFields(typ reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// suggest returns a hint about the key in fields closest to key, if any.
+func suggest(key string, fields map[string]reflect.Type) string {
+	best, bestDist := "", 3
+	for name := range fields {
+		dist := editDistance(key, name)
+		if dist < bestDist || (dist == bestDist && name < best) {
+			best, bestDist = name, dist
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf("; did you mean %q?", best)
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func checkWhen(when *yaml.Node, diags *Diagnostics) {
+	if when == nil || when.Kind != yaml.ScalarNode {
+		return
+	}
+	_, err := expr.Parse(when.Value)
+	if err != nil {
+		*diags = append(*diags, At(when, "invalid condition: %v", err))
+	}
+}
+
+// untag returns a deep copy of node without ResetTag tags.
+func untag(node *yaml.Node) *yaml.Node {
+	cp := *node
+	if cp.Tag == ResetTag {
+		cp.Tag = ""
+	}
+	cp.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		cp.Content[i] = untag(child)
+	}
+	return &cp
+}
+
+// forEachValue calls fn for each value of the mapping node.
+func forEachValue(node *yaml.Node, fn func(*yaml.Node)) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 1; i < len(node.Content); i += 2 {
+		fn(node.Content[i])
+	}
+}
+
+// valueOf returns the value of key in the mapping node, or nil.
+func valueOf(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package service_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/livingsilver94/backee/service"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		doc      string
+		expected []string
+	}{
+		{doc: "copies: {a: b}\nsetup: {run: x, when: 'os == \"linux\"'}"},
+		{doc: "packages: !reset [git]\nlinks: {a: null}"},
+		{doc: "copys: {a: b}", expected: []string{`1:1: unknown key "copys"; did you mean "copies"?`}},
+		{doc: "links:\n  a: {path: b, mod: 0o644}", expected: []string{`2:16: unknown key "mod"; did you mean "mode"?`}},
+		{doc: "links:\n  a: {path: b, mode: 0o17777}", expected: []string{"2:22: file mode 0o17777 is out of range"}},
+		{doc: "variables:\n  a: {kind: vault, value: b}", expected: []string{`2:13: unknown variable kind "vault"`}},
+		{doc: "finalize:\n  run: x\n  when: 'os =='", expected: []string{"3:9: invalid condition: syntax error at column 6: unexpected end of expression"}},
+		{doc: "depends: {a: b}", expected: []string{"1: cannot unmarshal !!map into []string"}},
+		{
+			doc:      "zzz: 1\npackages: [{name: a, version: 1}]",
+			expected: []string{`1:1: unknown key "zzz"`, `2:22: unknown key "version"`},
+		},
+	}
+	for _, test := range tests {
+		var doc yaml.Node
+		err := yaml.Unmarshal([]byte(test.doc), &doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diags := service.Check(&doc)
+		if len(diags) != len(test.expected) {
+			t.Fatalf("expected %d problems in %q. Got %v", len(test.expected), test.doc, diags)
+		}
+		for i, diag := range diags {
+			// Expectations may be prefixes.
+			if !strings.HasPrefix(diag.Error(), test.expected[i]) {
+				t.Fatalf("expected problem %q in %q. Got %q", test.expected[i], test.doc, diag.Error())
+			}
+		}
+	}
+}
+
+func TestParseUnknownKey(t *testing.T) {
+	_, err := service.NewFromYAML(name, []byte("finalise: echo"))
+	var diags service.Diagnostics
+	if !errors.As(err, &diags) || len(diags) != 1 || diags[0].Line != 1 {
+		t.Fatalf("expected a problem on line 1. Got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package service
+
+import "gopkg.in/yaml.v3"
+
+// ResetTag marks a YAML value that replaces, instead of merging with,
+// the value it overrides. Without a value, it removes the overridden one.
+const ResetTag = "!reset"
+
+// replacedKeys are keys whose lists replace, instead of appending to,
+// the lists they override.
+var replacedKeys = map[string]bool{
+	"pkgmanager": true,
+}
+
+// MergeYAML deep-merges overlay over base, which may be nil, and returns the result.
+// Mappings are merged by key and lists are appended, except for keys such as
+// pkgmanager. Other values of overlay replace those of base.
+// A null value, or a value tagged with ResetTag, in overlay removes
+// or replaces the matching value of base, respectively.
+// MergeYAML may modify base and overlay.
+func MergeYAML(base, overlay *yaml.Node) *yaml.Node {
+	return merge(content(base), content(overlay), false)
+}
+
+// content returns the root node of a YAML document,
+// or the node itself if it's not a document.
+func content(node *yaml.Node) *yaml.Node {
+	if node != nil && node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return node.Content[0]
+	}
+	return node
+}
+
+func merge(base, overlay *yaml.Node, replace bool) *yaml.Node {
+	if overlay == nil {
+		return base
+	}
+	if isRemoval(overlay) {
+		return nil
+	}
+	if overlay.Tag == ResetTag {
+		overlay.Tag = ""
+		replace = true
+	}
+	if base == nil || replace || base.Kind != overlay.Kind {
+		return clean(overlay)
+	}
+	switch overlay.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(overlay.Content)-1; i += 2 {
+			key, val := overlay.Content[i], overlay.Content[i+1]
+			j := mappingIndex(base, key.Value)
+			if j < 0 {
+				if val = merge(nil, val, false); val != nil {
+					base.Content = append(base.Content, key, val)
+				}
+				continue
+			}
+			if val = merge(base.Content[j+1], val, replacedKeys[key.Value]); val != nil {
+				base.Content[j+1] = val
+			} else {
+				base.Content = append(base.Content[:j], base.Content[j+2:]...)
+			}
+		}
+		return base
+	case yaml.SequenceNode:
+		base.Content = append(base.Content, clean(overlay).Content...)
+		return base
+	default:
+		return clean(overlay)
+	}
+}
+
+// clean drops null entries of mappings in node, which have nothing
+// left to remove, and the ResetTag of values, recursively.
+func clean(node *yaml.Node) *yaml.Node {
+	if node.Tag == ResetTag {
+		node.Tag = ""
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		content := node.Content[:0]
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			if isRemoval(val) {
+				continue
+			}
+			content = append(content, key, clean(val))
+		}
+		node.Content = content
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			clean(item)
+		}
+	}
+	return node
+}
+
+// isRemoval returns whether node asks to remove the value it overrides.
+func isRemoval(node *yaml.Node) bool {
+	if node.Kind != yaml.ScalarNode {
+		return false
+	}
+	if node.Tag == ResetTag {
+		// A quoted empty string is a value.
+		return node.Value == "" && node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) == 0
+	}
+	return node.Tag == "!!null"
+}
+
+// mappingIndex returns the index of key in the mapping node, or -1.
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package service_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/livingsilver94/backee/service"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMergeYAML(t *testing.T) {
+	const base = `
+pkgmanager: [dnf, install]
+packages: [git, vim]
+setup: echo base
+links:
+  a.conf: /etc/a.conf
+  b.conf:
+    path: /etc/b.conf
+    mode: 0o600
+variables:
+  user: admin
+  shell: bash`
+	const overlay = `
+pkgmanager: [apt-get, install]
+packages: [curl]
+depends: !reset [net]
+links:
+  a.conf: null
+  b.conf:
+    path: /opt/b.conf
+  c.conf: /etc/c.conf
+variables:
+  user: root
+  shell: !reset
+  new: ~`
+	node := service.MergeYAML(parseYAML(t, base), parseYAML(t, overlay))
+	srv := service.New(name)
+	err := node.Decode(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []string{"apt-get", "install"}; !reflect.DeepEqual(srv.PkgManager, expect) {
+		t.Fatalf("expected pkgmanager %v. Found %v", expect, srv.PkgManager)
+	}
+	expectPkgs := []service.Package{{Name: "git"}, {Name: "vim"}, {Name: "curl"}}
+	if !reflect.DeepEqual(srv.Packages, expectPkgs) {
+		t.Fatalf("expected packages %v. Found %v", expectPkgs, srv.Packages)
+	}
+	if srv.Setup == nil || srv.Setup.Run != "echo base" {
+		t.Fatalf("expected setup to be preserved. Found %v", srv.Setup)
+	}
+	if srv.Depends == nil || !srv.Depends.Contains("net") {
+		t.Fatalf("expected depends to contain net. Found %v", srv.Depends)
+	}
+	expectLinks := map[string]service.FilePath{
+		"b.conf": {Path: "/opt/b.conf", Mode: 0o600},
+		"c.conf": {Path: "/etc/c.conf"},
+	}
+	if !reflect.DeepEqual(srv.Links, expectLinks) {
+		t.Fatalf("expected links %v. Found %v", expectLinks, srv.Links)
+	}
+	expectVars := map[string]service.VarValue{
+		service.VarDatadir: {Kind: service.Datadir, Value: name},
+		"user":             {Kind: service.ClearText, Value: "root"},
+	}
+	if !reflect.DeepEqual(srv.Variables, expectVars) {
+		t.Fatalf("expected variables %v. Found %v", expectVars, srv.Variables)
+	}
+}
+
+func TestMergeYAMLEmpty(t *testing.T) {
+	empty := &yaml.Node{Kind: yaml.DocumentNode}
+	node := service.MergeYAML(service.MergeYAML(nil, empty), empty)
+	if node != nil {
+		t.Fatalf("expected nil node. Got %v", node)
+	}
+}
+
+func parseYAML(t *testing.T, text string) *yaml.Node {
+	t.Helper()
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte(text), &node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &node
+}
@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// SchemaDraft is the JSON Schema dialect of JSONSchema.
+const SchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// shorthands are types that may be written as a string, instead of an object.
+var shorthands = map[reflect.Type]bool{
+	reflect.TypeOf(FilePath{}): true,
+	reflect.TypeOf(Script{}):   true,
+	reflect.TypeOf(Package{}):  true,
+	reflect.TypeOf(VarValue{}): true,
+}
+
+// required lists the keys that the object form of a type requires.
+var required = map[reflect.Type][]string{
+	reflect.TypeOf(Package{}): {"name"},
+}
+
+// JSONSchema returns a JSON Schema of service files, generated from the types
+// of the YAML keys of Service. extra are additional top-level properties.
+func JSONSchema(extra map[string]any) ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(Service{}))
+	props := schema["properties"].(map[string]any)
+	for key, prop := range props {
+		// Empty keys are allowed, and null removes a value of a variant.
+		props[key] = nullable(prop.(map[string]any))
+	}
+	for key, prop := range extra {
+		props[key] = prop
+	}
+	schema["$schema"] = SchemaDraft
+	schema["title"] = "Backee service"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func typeSchema(typ reflect.Type) map[string]any {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch typ {
+	case reflect.TypeOf(DepSet{}):
+		return map[string]any{"type": "array", "items": map[string]any{"type": "string"}}
+	case reflect.TypeOf(ConflictPolicy("")):
+		return enum(ConflictFail, ConflictSkip, ConflictOverwrite, ConflictBackup)
+	case reflect.TypeOf(TemplateEngine("")):
+		return enum(EnginePlain, EngineGo)
+	case reflect.TypeOf(VarKind("")):
+		return enum(VarKinds()...)
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return map[string]any{"type": "integer", "minimum": 0, "maximum": MaxMode}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(typ.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": nullable(typeSchema(typ.Elem()))}
+	case reflect.Struct:
+		props := make(map[string]any)
+		for key, field := range yamlFields(typ) {
+			props[key] = typeSchema(field)
+		}
+		obj := map[string]any{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+		if req, ok := required[typ]; ok {
+			obj["required"] = req
+		}
+		if shorthands[typ] {
+			return map[string]any{"oneOf": []any{map[string]any{"type": "string"}, obj}}
+		}
+		return obj
+	}
+	return map[string]any{}
+}
+
+func nullable(schema map[string]any) map[string]any {
+	return map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+}
+
+func enum[T ~string](values ...T) map[string]any {
+	strs := make([]string, 0, len(values))
+	for _, val := range values {
+		strs = append(strs, string(val))
+	}
+	return map[string]any{"type": "string", "enum": strs}
+}
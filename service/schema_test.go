@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: Fabio Forni <development@redaril.me>
+// SPDX-License-Identifier: MPL-2.0
+
+package service_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/livingsilver94/backee/service"
+)
+
+func TestJSONSchema(t *testing.T) {
+	data, err := service.JSONSchema(map[string]any{"extra": map[string]any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties map[string]struct {
+			AnyOf []json.RawMessage `json:"anyOf"`
+		} `json:"properties"`
+	}
+	err = json.Unmarshal(data, &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ := reflect.TypeOf(service.Service{})
+	for i := 0; i < typ.NumField(); i++ {
+		key := typ.Field(i).Tag.Get("yaml")
+		if _, ok := schema.Properties[key]; !ok && key != "-" {
+			t.Fatalf("expected property %q in the schema", key)
+		}
+	}
+	if _, ok := schema.Properties["extra"]; !ok {
+		t.Fatal("expected extra property in the schema")
+	}
+
+	// Variables are either strings or objects with a registered kind.
+	var vars struct {
+		AdditionalProperties struct {
+			AnyOf []struct {
+				OneOf []struct {
+					Type       string `json:"type"`
+					Properties struct {
+						Kind struct {
+							Enum []service.VarKind `json:"enum"`
+						} `json:"kind"`
+					} `json:"properties"`
+				} `json:"oneOf"`
+			} `json:"anyOf"`
+		} `json:"additionalProperties"`
+	}
+	err = json.Unmarshal(schema.Properties["variables"].AnyOf[0], &vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forms := vars.AdditionalProperties.AnyOf[0].OneOf
+	if len(forms) != 2 || forms[0].Type != "string" || forms[1].Type != "object" {
+		t.Fatalf("expected string or object variables. Got %+v", forms)
+	}
+	if !reflect.DeepEqual(forms[1].Properties.Kind.Enum, service.VarKinds()) {
+		t.Fatalf("expected kinds %v. Got %v", service.VarKinds(), forms[1].Properties.Kind.Enum)
+	}
+}
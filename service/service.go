@@ -5,7 +5,11 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/hashicorp/go-set"
 	"gopkg.in/yaml.v3"
@@ -28,8 +32,10 @@ const (
 )
 
 var (
-	// DefaultPkgManager is the default package manager command to install OS packages.
-	DefaultPkgManager = []string{"pkcon", "install", "-y"}
+	// DefaultPkgManager is the package manager command to install OS packages
+	// of services that don't define one. When nil, the installer
+	// picks a built-in package manager driver.
+	DefaultPkgManager []string
 )
 
 // Service is a collection of resources to reinstall/restore on an operating system.
@@ -41,18 +47,17 @@ type Service struct {
 	// Depends is a set of Service names upon which this Service depends.
 	Depends *DepSet `yaml:"depends"`
 
-	// Setup is a script (UNIX Shell or Powershell, depending on the operating system)
-	// to run before reinstalling and/or restoring any resources.
-	Setup *string `yaml:"setup"`
+	// Setup is a script to run before reinstalling and/or restoring any resources.
+	Setup *Script `yaml:"setup"`
 
 	// PkgManager is combination of command name
 	// and arguments to reinstall operating system packages.
 	// It must accept a list of package names appended to it.
+	// When empty, a package manager driver installs Packages instead.
 	PkgManager []string `yaml:"pkgmanager"`
 
-	// Packages is a list of operating system packages to reinstall.
-	// It will be appended as-is to PkgManager.
-	Packages []string `yaml:"packages"`
+	// Packages is a list of operating system packages to install.
+	Packages []Package `yaml:"packages"`
 
 	// Links is a collection of symlinks to restore. Their source path
 	// is relative to Service's linkdir.
@@ -69,9 +74,11 @@ type Service struct {
 	// to customize the content.
 	Copies map[string]FilePath `yaml:"copies"`
 
-	// Setup is a script (UNIX Shell or Powershell, depending on the operating system)
-	// to run after reinstalling and/or restoring any resources.
-	Finalize *string `yaml:"finalize"`
+	// Finalize is a script to run after reinstalling and/or restoring any resources.
+	Finalize *Script `yaml:"finalize"`
+
+	// Uninstall is a script to run before removing the restored resources.
+	Uninstall *Script `yaml:"uninstall"`
 }
 
 // New creates a Service with a given name. Variables will contain VarDatadir
@@ -87,21 +94,64 @@ func New(name string) *Service {
 }
 
 // NewFromYAML creates a Service with a given name whose fields are defined by
-// a buffered YAML document.
+// a buffered YAML document. The document is checked as in Check.
 func NewFromYAML(name string, yml []byte) (*Service, error) {
-	srv := New(name)
-	return srv, yaml.Unmarshal(yml, srv)
+	var doc yaml.Node
+	err := yaml.Unmarshal(yml, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromYAMLNode(name, &doc)
 }
 
 // NewFromYAML creates a Service with a given name whose fields are defined by
-// a streaming YAML document.
+// a streaming YAML document. The document is checked as in Check.
 func NewFromYAMLReader(name string, rd io.Reader) (*Service, error) {
+	var doc yaml.Node
+	err := yaml.NewDecoder(rd).Decode(&doc)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return NewFromYAMLNode(name, &doc)
+}
+
+// NewFromYAMLNode creates a Service with a given name whose fields are defined by
+// a parsed YAML document. If Check finds problems in doc, they are returned as Diagnostics.
+func NewFromYAMLNode(name string, doc *yaml.Node) (*Service, error) {
 	srv := New(name)
-	err := yaml.NewDecoder(rd).Decode(srv)
-	if errors.Is(err, io.EOF) {
-		err = nil
+	if doc.Kind == 0 {
+		return srv, nil
+	}
+	if diags := Check(doc); len(diags) != 0 {
+		return nil, diags
 	}
-	return srv, err
+	return srv, doc.Decode(srv)
+}
+
+// Placeholders returns the variable names enclosed by VarOpenTag and VarCloseTag
+// in s, in order of appearance and without duplicates.
+func Placeholders(s string) []string {
+	var names []string
+	seen := make(map[string]struct{})
+	for {
+		start := strings.Index(s, VarOpenTag)
+		if start < 0 {
+			break
+		}
+		s = s[start+len(VarOpenTag):]
+		end := strings.Index(s, VarCloseTag)
+		if end < 0 {
+			break
+		}
+		name := s[:end]
+		s = s[end+len(VarCloseTag):]
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	return names
 }
 
 // Hash returns a string that uniquely identifies this Service.
@@ -145,6 +195,20 @@ func (ds *DepSet) UnmarshalYAML(node *yaml.Node) error {
 type FilePath struct {
 	Path string `yaml:"path"`
 	Mode uint16 `yaml:"mode"`
+	// Conflict is what to do when Path already exists.
+	// When empty, the installer decides.
+	Conflict ConflictPolicy `yaml:"conflict"`
+	// Engine renders copied files. When empty, it is EngineGo
+	// for files with GoTemplateExt extension, optionally followed by AgeExt,
+	// and EnginePlain otherwise.
+	// Links ignore it.
+	Engine TemplateEngine `yaml:"engine"`
+	// When is a condition that must hold for the file to be linked or copied.
+	When string `yaml:"when"`
+
+	// Backup is where Path is moved to when Conflict is ConflictBackup.
+	// It is never read from YAML, but set by the installer.
+	Backup string `yaml:"-"`
 }
 
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
@@ -156,8 +220,7 @@ func (lp *FilePath) UnmarshalYAML(node *yaml.Node) error {
 		if err != nil {
 			return err
 		}
-		lp.Path = path
-		lp.Mode = 0
+		*lp = FilePath{Path: path}
 	default:
 		type noRecursion FilePath
 		var noRec noRecursion
@@ -170,6 +233,145 @@ func (lp *FilePath) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
+// Script is a UNIX Shell or Powershell script, depending on the operating system.
+type Script struct {
+	// Run is the code of the script.
+	Run string `yaml:"run"`
+	// When is a condition that must hold for the script to run.
+	When string `yaml:"when"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (sc *Script) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var run string
+		err := node.Decode(&run)
+		if err != nil {
+			return err
+		}
+		*sc = Script{Run: run}
+	default:
+		type noRecursion Script
+		var noRec noRecursion
+		err := node.Decode(&noRec)
+		if err != nil {
+			return err
+		}
+		*sc = Script(noRec)
+	}
+	return nil
+}
+
+// Package is an operating system package.
+type Package struct {
+	// Name is the package name.
+	Name string `yaml:"name"`
+	// Names maps package manager driver names to the name
+	// of the package for that driver, when it differs from Name.
+	Names map[string]string `yaml:"names"`
+	// When is a condition that must hold for the package to be installed.
+	When string `yaml:"when"`
+}
+
+// NameFor returns the name of the package for the driver named driver.
+func (p Package) NameFor(driver string) string {
+	if name, ok := p.Names[driver]; ok {
+		return name
+	}
+	return p.Name
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (p *Package) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var name string
+		err := node.Decode(&name)
+		if err != nil {
+			return err
+		}
+		*p = Package{Name: name}
+	default:
+		type noRecursion Package
+		var noRec noRecursion
+		err := node.Decode(&noRec)
+		if err != nil {
+			return err
+		}
+		if noRec.Name == "" {
+			return fmt.Errorf("line %d: package without a name", node.Line)
+		}
+		*p = Package(noRec)
+	}
+	return nil
+}
+
+// ConflictPolicy is the action taken when
+// the destination of a link or a copy already exists.
+type ConflictPolicy string
+
+const (
+	// ConflictFail makes the installation fail.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictSkip leaves the existing file untouched.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing file.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictBackup renames the existing file, then replaces it.
+	ConflictBackup ConflictPolicy = "backup"
+)
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (c *ConflictPolicy) UnmarshalText(text []byte) error {
+	switch pol := ConflictPolicy(text); pol {
+	case "", ConflictFail, ConflictSkip, ConflictOverwrite, ConflictBackup:
+		*c = pol
+		return nil
+	default:
+		return fmt.Errorf("invalid conflict policy %q", pol)
+	}
+}
+
+// TemplateEngine is the engine that renders copied files.
+type TemplateEngine string
+
+const (
+	// EnginePlain only replaces variable placeholders.
+	EnginePlain TemplateEngine = "plain"
+	// EngineGo renders files with Go's text/template package.
+	EngineGo TemplateEngine = "go"
+)
+
+// GoTemplateExt is the extension of files that EngineGo renders by default.
+const GoTemplateExt = ".gotmpl"
+
+// AgeExt is the extension of copied files encrypted with age.
+// They are decrypted before being rendered.
+const AgeExt = ".age"
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (e *TemplateEngine) UnmarshalText(text []byte) error {
+	switch eng := TemplateEngine(text); eng {
+	case "", EnginePlain, EngineGo:
+		*e = eng
+		return nil
+	default:
+		return fmt.Errorf("invalid template engine %q", eng)
+	}
+}
+
+// EngineFor returns the engine that renders the copied file src.
+func (fp FilePath) EngineFor(src string) TemplateEngine {
+	if fp.Engine != "" {
+		return fp.Engine
+	}
+	if strings.HasSuffix(strings.TrimSuffix(src, AgeExt), GoTemplateExt) {
+		return EngineGo
+	}
+	return EnginePlain
+}
+
 // VarKind is a kind of variable.
 // Any non-ClearText kind will require a solver to extract the value.
 type VarKind string
@@ -181,8 +383,50 @@ const (
 
 	// Datadir is the path of a Service's data directory.
 	Datadir VarKind = "datadir"
+
+	// Encrypted is a value encrypted with age, in the armored format.
+	Encrypted VarKind = "encrypted"
+)
+
+var (
+	// varKinds are the valid VarKinds.
+	varKinds   = []VarKind{ClearText, Datadir, Encrypted}
+	varKindsMu sync.RWMutex
 )
 
+// RegisterVarKind makes kind a valid VarKind. Packages that provide
+// solvers for kind register it during initialization.
+func RegisterVarKind(kind VarKind) {
+	varKindsMu.Lock()
+	defer varKindsMu.Unlock()
+	if !slices.Contains(varKinds, kind) {
+		varKinds = append(varKinds, kind)
+	}
+}
+
+// VarKinds returns the valid VarKinds, in registration order.
+func VarKinds() []VarKind {
+	varKindsMu.RLock()
+	defer varKindsMu.RUnlock()
+	return slices.Clone(varKinds)
+}
+
+// IsVarKind returns whether kind was registered.
+func IsVarKind(kind VarKind) bool {
+	varKindsMu.RLock()
+	defer varKindsMu.RUnlock()
+	return slices.Contains(varKinds, kind)
+}
+
+func joinKinds() string {
+	kinds := VarKinds()
+	names := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		names = append(names, string(kind))
+	}
+	return strings.Join(names, ", ")
+}
+
 // VarValue is a variable's value.
 type VarValue struct {
 	// Kind is the variable kind. Unless it's ClearText, a solver is required
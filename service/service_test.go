@@ -62,8 +62,37 @@ setup: |
 	if srv.Setup == nil {
 		t.Fatal("nil value")
 	}
-	if *srv.Setup != expect {
-		t.Fatalf("expected setup %q. Found %q", expect, *srv.Setup)
+	if srv.Setup.Run != expect {
+		t.Fatalf("expected setup %q. Found %q", expect, srv.Setup.Run)
+	}
+}
+
+func TestParseWhen(t *testing.T) {
+	const doc = `
+setup:
+  run: echo setup
+  when: os == "linux"
+finalize: echo finalize
+packages:
+  - {name: tlp, when: tagged("laptop")}
+links:
+  file: {path: /dest, when: command("git")}`
+	srv, err := service.NewFromYAML(name, []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := service.Script{Run: "echo setup", When: `os == "linux"`}
+	if *srv.Setup != expected {
+		t.Fatalf("expected setup %v. Found %v", expected, *srv.Setup)
+	}
+	if srv.Finalize.Run != "echo finalize" || srv.Finalize.When != "" {
+		t.Fatalf("expected unconditional finalizer. Found %v", *srv.Finalize)
+	}
+	if srv.Packages[0].When != `tagged("laptop")` {
+		t.Fatalf("expected package condition %q. Found %q", `tagged("laptop")`, srv.Packages[0].When)
+	}
+	if srv.Links["file"].When != `command("git")` {
+		t.Fatalf("expected link condition %q. Found %q", `command("git")`, srv.Links["file"].When)
 	}
 }
 
@@ -81,12 +110,18 @@ pkgmanager: ["sudo", "apt-get", "install", "-y"]`
 }
 
 func TestParsePackages(t *testing.T) {
-	expect := []string{"nano", "micro", "zsh"}
+	expect := []service.Package{
+		{Name: "nano"},
+		{Name: "micro"},
+		{Name: "fd", Names: map[string]string{"apt": "fd-find"}},
+	}
 	const doc = `
 packages:
   - nano
   - micro
-  - zsh`
+  - name: fd
+    names:
+      apt: fd-find`
 	srv, err := service.NewFromYAML(name, []byte(doc))
 	if err != nil {
 		t.Fatal(err)
@@ -96,6 +131,16 @@ packages:
 	}
 }
 
+func TestPackageNameFor(t *testing.T) {
+	pkg := service.Package{Name: "fd", Names: map[string]string{"apt": "fd-find"}}
+	if name := pkg.NameFor("apt"); name != "fd-find" {
+		t.Fatalf("expected name %q for apt. Got %q", "fd-find", name)
+	}
+	if name := pkg.NameFor("dnf"); name != "fd" {
+		t.Fatalf("expected name %q for dnf. Got %q", "fd", name)
+	}
+}
+
 func TestParseLinks(t *testing.T) {
 	expect := map[string]service.FilePath{
 		"/my/path/file1": {Path: "/tmp/alias1", Mode: 0o000},
@@ -139,7 +184,7 @@ links:
 func TestParseVariables(t *testing.T) {
 	expect := map[string]service.VarValue{
 		"username":         {Kind: service.ClearText, Value: "value1"},
-		"password":         {Kind: service.VarKind("keepassxc"), Value: "dbKey"},
+		"password":         {Kind: service.Encrypted, Value: "dbKey"},
 		"implicitKind":     {Kind: service.ClearText, Value: "value2"},
 		"scalar":           {Kind: service.ClearText, Value: "value3"},
 		service.VarDatadir: {Kind: service.Datadir, Value: name},
@@ -150,7 +195,7 @@ variables:
     kind: cleartext
     value: value1
   password:
-    kind: keepassxc
+    kind: encrypted
     value: dbKey
   implicitKind:
     value: value2
@@ -234,8 +279,16 @@ finalize: |
 	if srv.Finalize == nil {
 		t.Fatal("nil value")
 	}
-	if *srv.Finalize != expect {
-		t.Fatalf("expected finalize script %q. Found %q", expect, *srv.Finalize)
+	if srv.Finalize.Run != expect {
+		t.Fatalf("expected finalize script %q. Found %q", expect, srv.Finalize.Run)
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	expect := []string{"var1", "parent.var2"}
+	obtained := service.Placeholders("a {{var1}} b {{parent.var2}} c {{var1}} {{unclosed")
+	if !reflect.DeepEqual(obtained, expect) {
+		t.Fatalf("expected placeholders %v. Found %v", expect, obtained)
 	}
 }
 
@@ -247,3 +300,73 @@ func TestServiceHash(t *testing.T) {
 		t.Fatalf("expected %s. Got %s", expected, obtained)
 	}
 }
+
+func TestParseUninstall(t *testing.T) {
+	const expect = "systemctl disable --now nginx.service"
+	const doc = `
+uninstall: systemctl disable --now nginx.service`
+	srv, err := service.NewFromYAML(name, []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.Uninstall == nil {
+		t.Fatal("nil value")
+	}
+	if srv.Uninstall.Run != expect {
+		t.Fatalf("expected uninstall script %q. Found %q", expect, srv.Uninstall.Run)
+	}
+}
+
+func TestParseConflict(t *testing.T) {
+	expect := map[string]service.FilePath{
+		"bashrc": {Path: "/home/user/.bashrc", Conflict: service.ConflictBackup},
+	}
+	const doc = `
+copies:
+  bashrc:
+    path: /home/user/.bashrc
+    conflict: backup`
+	srv, err := service.NewFromYAML(name, []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(srv.Copies, expect) {
+		t.Fatalf("expected copies %v. Found %v", expect, srv.Copies)
+	}
+}
+
+func TestParseEngine(t *testing.T) {
+	const doc = `
+copies:
+  bashrc:
+    path: /home/user/.bashrc
+    engine: go
+  zshrc: /home/user/.zshrc
+  vimrc.gotmpl: /home/user/.vimrc`
+	srv, err := service.NewFromYAML(name, []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]service.TemplateEngine{
+		"bashrc":       service.EngineGo,
+		"zshrc":        service.EnginePlain,
+		"vimrc.gotmpl": service.EngineGo,
+	}
+	for src, eng := range expect {
+		if obtained := srv.Copies[src].EngineFor(src); obtained != eng {
+			t.Fatalf("expected engine %q for %s. Found %q", eng, src, obtained)
+		}
+	}
+}
+
+func TestParseConflictInvalid(t *testing.T) {
+	const doc = `
+copies:
+  bashrc:
+    path: /home/user/.bashrc
+    conflict: explode`
+	_, err := service.NewFromYAML(name, []byte(doc))
+	if err == nil {
+		t.Fatal("expected an error for an invalid conflict policy")
+	}
+}